@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -155,60 +156,220 @@ func (r *Redis) setDefaults() {
 }
 
 type ProtocolSettings struct {
+	Alert          AlertSettings
 	Recommendation RecommendationSettings
 	Intelligence   IntelligenceSettings
 	FileShare      FileShareSettings
 }
 
 func (ps *ProtocolSettings) validate() error {
-	for sev, settings := range ps.FileShare.MetaSpreadSettings {
+	if err := ps.Intelligence.validate(); err != nil {
+		return err
+	}
+	if ps.FileShare.ChunkSize < 0 || ps.FileShare.MaxChunkSize < 0 {
+		return errors.New("ProtocolSettings.FileShare.ChunkSize and MaxChunkSize cannot be negative")
+	}
+	// zero sizes are replaced by defaults, so check the values really used
+	withDefaults := ps.FileShare
+	withDefaults.setDefaults()
+	if withDefaults.ChunkSize > withDefaults.MaxChunkSize {
+		return errors.Errorf("ProtocolSettings.FileShare.ChunkSize=%d cannot be larger than MaxChunkSize=%d",
+			withDefaults.ChunkSize, withDefaults.MaxChunkSize)
+	}
+	if ps.FileShare.MaxParallelProviders < 0 || ps.FileShare.ChunksPerRequest < 0 {
+		return errors.New("ProtocolSettings.FileShare.MaxParallelProviders and ChunksPerRequest cannot be negative")
+	}
+	if ps.FileShare.ExpiryCheckPeriod < 0 {
+		return errors.New("ProtocolSettings.FileShare.ExpiryCheckPeriod cannot be negative")
+	}
+	if ps.FileShare.MaxFileSize < 0 || ps.FileShare.MaxDownloadSize < 0 ||
+		ps.FileShare.DownloadDirQuota < 0 || ps.FileShare.MinFreeDiskSpace < 0 {
+		return errors.New("ProtocolSettings.FileShare download limits cannot be negative")
+	}
+	for _, c := range ps.FileShare.Compressions {
+		if c != "zstd" && c != "gzip" && !(c == "none" && len(ps.FileShare.Compressions) == 1) {
+			return errors.Errorf("unknown compression ProtocolSettings.FileShare.Compressions=%s", c)
+		}
+	}
+	if ps.Alert.RevocationWindow < 0 {
+		return errors.New("ProtocolSettings.Alert.RevocationWindow cannot be negative")
+	}
+	if err := validateSpreadSettings("Alert.SpreadSettings", ps.Alert.SpreadSettings); err != nil {
+		return err
+	}
+	return validateSpreadSettings("FileShare.MetaSpreadSettings", ps.FileShare.MetaSpreadSettings)
+}
+
+// validateSpreadSettings checks spreading strategies configured per severity.
+// Name is used only to tell the user which part of the config is wrong
+func validateSpreadSettings(name string, spreadSettings map[string]SpreadStrategy) error {
+	for sev, settings := range spreadSettings {
 		uSev := strings.ToUpper(sev)
 		if uSev != "MINOR" && uSev != "MAJOR" && uSev != "CRITICAL" {
-			return errors.Errorf("unknown severity ProtocolSettings.FileShare.MetaSpreadSettings=%s", uSev)
+			return errors.Errorf("unknown severity ProtocolSettings.%s=%s", name, uSev)
 		}
 		if settings.NumberOfPeers <= 0 {
-			log.Warnf("Config: ProtocolSettings.FileShare.MetaSpread"+
-				"Settings.%s.NumberOfPeers=%d - spreading disabled",
-				uSev, settings.NumberOfPeers)
+			log.Warnf("Config: ProtocolSettings.%s.%s.NumberOfPeers=%d - "+
+				"spreading disabled", name, uSev, settings.NumberOfPeers)
 			continue
 		}
 		if settings.Until <= 0 {
-			log.Warnf("Config: ProtocolSettings.FileShare.MetaSpread"+
-				"Settings.%s.Until=%s - undefined behavior", uSev, settings.Until)
+			log.Warnf("Config: ProtocolSettings.%s.%s.Until=%s - undefined "+
+				"behavior", name, uSev, settings.Until)
 		}
 		if settings.Every <= 0 {
-			log.Warnf("Config: ProtocolSettings.FileShare.MetaSpread"+
-				"Settings.%s.Every=%s - periodical spreading disabled",
-				uSev, settings.Every)
+			log.Warnf("Config: ProtocolSettings.%s.%s.Every=%s - periodical "+
+				"spreading disabled", name, uSev, settings.Every)
 		}
 	}
 	return nil
 }
 
 func (ps *ProtocolSettings) setDefaults() {
-	if ps.FileShare.DownloadDir == "" {
-		ps.FileShare.DownloadDir = "/tmp"
+	if ps.Alert.AggregationWindow == 0 {
+		ps.Alert.AggregationWindow = 5 * time.Second
 	}
-	if ps.Recommendation.Timeout == 0 {
-		ps.Recommendation.Timeout = 10 * time.Second
+	if ps.Alert.HistorySize == 0 {
+		ps.Alert.HistorySize = 500
 	}
-	if ps.Intelligence.MaxTtl == 0 {
-		ps.Intelligence.MaxTtl = 5
+	if ps.Alert.HistoryTtl == 0 {
+		ps.Alert.HistoryTtl = 15 * time.Minute
 	}
-	if ps.Intelligence.Ttl == 0 {
-		ps.Intelligence.Ttl = 4
+	if ps.Alert.RevocationWindow == 0 {
+		ps.Alert.RevocationWindow = 24 * time.Hour
 	}
-	if ps.Intelligence.RootTimeout == 0 {
-		ps.Intelligence.RootTimeout = 10 * time.Second
+	if ps.Alert.MaxRevocableAlerts == 0 {
+		ps.Alert.MaxRevocableAlerts = 10000
 	}
-	if ps.Intelligence.MaxParentTimeout == 0 {
-		ps.Intelligence.MaxParentTimeout = 10 * time.Second
+	if ps.Recommendation.Timeout == 0 {
+		ps.Recommendation.Timeout = 10 * time.Second
 	}
+	ps.Intelligence.setDefaults()
+	ps.FileShare.setDefaults()
+}
+
+type AlertSettings struct {
+	// SpreadSettings overrides default spreading strategies of alerts with
+	// severity. Alerts without severity are always flooded to all peers
+	SpreadSettings map[string]SpreadStrategy
+
+	// AggregationWindow is time for which alerts with the same content key
+	// are merged before they are sent to TL. Negative value disables
+	// aggregation. Defaults to 5 seconds
+	AggregationWindow time.Duration
+
+	// HistorySize is max number of recent alerts kept to be sent to peers
+	// that connect later. Negative value disables the history. Defaults to
+	// 500
+	HistorySize int
+
+	// HistoryTtl says how long alerts are kept in the history. Defaults to
+	// 15 minutes
+	HistoryTtl time.Duration
+
+	// RevocationWindow says how long after sending an alert TL can revoke
+	// it. Defaults to 24 hours
+	RevocationWindow time.Duration
+
+	// MaxRevocableAlerts is max number of recent alerts whose authors and
+	// routes are kept to process their revocations. Negative value disables
+	// revocations. Defaults to 10000
+	MaxRevocableAlerts int
 }
 
 type FileShareSettings struct {
 	MetaSpreadSettings map[string]SpreadStrategy
 	DownloadDir        string
+
+	// FeedStateFile is path of file where versions and heads of feeds of
+	// this peer are persisted. Defaults to feeds.json in DownloadDir
+	FeedStateFile string
+
+	// ChunkSize is size of chunks in bytes files are transferred in. It is
+	// set by the author of the file. Defaults to 1 MiB
+	ChunkSize int64
+	// MaxChunkSize is max chunk size of files the peer is willing to download
+	// or serve. Defaults to 16 MiB
+	MaxChunkSize int64
+
+	// MaxParallelProviders is number of providers chunks are downloaded from
+	// at the same time. Defaults to 4
+	MaxParallelProviders int
+	// ChunksPerRequest is number of chunks requested from a provider at once.
+	// Defaults to 16
+	ChunksPerRequest int
+
+	// ExpiryCheckPeriod says how often expiration of shared files is checked.
+	// Defaults to 1 minute
+	ExpiryCheckPeriod time.Duration
+	// DeleteExpiredFiles enables deleting of downloaded copies of files when
+	// they expire. Original files shared by TL are never deleted
+	DeleteExpiredFiles bool
+
+	// MaxFileSize is max size of a file announced in its metadata the peer
+	// is willing to download. Defaults to 1 GiB
+	MaxFileSize int64
+	// MaxDownloadSize is max number of bytes received in one download, it
+	// limits also files whose size is not announced. Defaults to MaxFileSize
+	MaxDownloadSize int64
+	// DownloadDirQuota is max total size of downloaded and partially
+	// downloaded files in DownloadDir. When a new download does not fit,
+	// unknown files and then the least recently used downloaded files are
+	// deleted. Defaults to 10 GiB
+	DownloadDirQuota int64
+	// MinFreeDiskSpace is space which must be left free on the disk of
+	// DownloadDir after a download. Defaults to 512 MiB
+	MinFreeDiskSpace int64
+
+	// Compressions are algorithms (zstd, gzip) used for file transfer in order
+	// of preference. Defaults to zstd and gzip, "none" disables compression
+	Compressions []string
+
+	// DropNonMatchingMetadata drops received file metadata which do not match
+	// any subscription of TL. By default, such metadata are kept, so TL can
+	// still download the file, but TL is not notified about them
+	DropNonMatchingMetadata bool
+}
+
+func (fs *FileShareSettings) setDefaults() {
+	if fs.DownloadDir == "" {
+		fs.DownloadDir = "/tmp"
+	}
+	if fs.FeedStateFile == "" {
+		fs.FeedStateFile = filepath.Join(fs.DownloadDir, "feeds.json")
+	}
+	if fs.ChunkSize == 0 {
+		fs.ChunkSize = 1 << 20
+	}
+	if fs.MaxChunkSize == 0 {
+		fs.MaxChunkSize = 16 << 20
+	}
+	if fs.MaxParallelProviders == 0 {
+		fs.MaxParallelProviders = 4
+	}
+	if fs.ChunksPerRequest == 0 {
+		fs.ChunksPerRequest = 16
+	}
+	if fs.ExpiryCheckPeriod == 0 {
+		fs.ExpiryCheckPeriod = time.Minute
+	}
+	if fs.MaxFileSize == 0 {
+		fs.MaxFileSize = 1 << 30
+	}
+	if fs.MaxDownloadSize == 0 {
+		fs.MaxDownloadSize = fs.MaxFileSize
+	}
+	if fs.DownloadDirQuota == 0 {
+		fs.DownloadDirQuota = 10 << 30
+	}
+	if fs.MinFreeDiskSpace == 0 {
+		fs.MinFreeDiskSpace = 512 << 20
+	}
+	if len(fs.Compressions) == 0 {
+		fs.Compressions = []string{"zstd", "gzip"}
+	} else if len(fs.Compressions) == 1 && fs.Compressions[0] == "none" {
+		fs.Compressions = []string{}
+	}
 }
 
 type SpreadStrategy struct {
@@ -226,6 +387,103 @@ type IntelligenceSettings struct {
 	Ttl              uint32        // ttl to set when initiating intelligence request
 	MaxParentTimeout time.Duration // max allowed timeout parent is waiting (so he does not make me stuck waiting forever)
 	RootTimeout      time.Duration // timeout for responses after initiating intelligence request
+	ResponseMargin   time.Duration // time reserved at every hop for aggregating and sending responses to parent
+	MinForwardBudget time.Duration // request is not forwarded if children would have less time to respond
+
+	Fanout      int     // number of peers to send the request to when initiating it
+	FanoutDecay float64 // fanout is multiplied by this factor with every hop, must be in (0, 1], 0 means default
+	MinFanout   int     // lower bound of fanout decayed with hops
+
+	// AdaptiveFanout raises fanout (up to MaxFanout) when ratio of peers
+	// responding they did not process the request exceeds UnprocessedThreshold
+	AdaptiveFanout       bool
+	MaxFanout            int
+	UnprocessedThreshold float64
+
+	// StreamPartialResults makes the requester deliver every verified
+	// response to TL as soon as it arrives instead of waiting for all of them
+	StreamPartialResults bool
+
+	// ResponseCache enables caching of TL's responses to requests with cache
+	// key. TL decides how long is its response cached, at most MaxResponseCacheTtl
+	ResponseCache       bool
+	ResponseCacheSize   int
+	MaxResponseCacheTtl time.Duration
+
+	// Topics this peer is expert in (e.g. IP prefixes or ASNs). They are
+	// advertised in DHT, so requests with these topics are routed to this peer
+	Topics             []string
+	TopicLookupTimeout time.Duration // max time spent looking for topic experts in DHT
+}
+
+func (is *IntelligenceSettings) validate() error {
+	if is.Fanout < 0 || is.MinFanout < 0 || is.MaxFanout < 0 {
+		return errors.New("ProtocolSettings.Intelligence fanout values cannot be negative")
+	}
+	if is.FanoutDecay < 0 || is.FanoutDecay > 1 {
+		return errors.Errorf("ProtocolSettings.Intelligence.FanoutDecay=%f must be in (0, 1] or 0 for default",
+			is.FanoutDecay)
+	}
+	if is.ResponseCacheSize < 0 {
+		return errors.New("ProtocolSettings.Intelligence.ResponseCacheSize cannot be negative")
+	}
+	if is.UnprocessedThreshold < 0 || is.UnprocessedThreshold > 1 {
+		return errors.Errorf("ProtocolSettings.Intelligence.UnprocessedThreshold=%f must be in (0, 1] or 0 for default",
+			is.UnprocessedThreshold)
+	}
+	// zero fanouts are replaced by defaults, so check the values really used
+	withDefaults := *is
+	withDefaults.setDefaults()
+	if withDefaults.MinFanout > withDefaults.Fanout || withDefaults.Fanout > withDefaults.MaxFanout {
+		return errors.Errorf("ProtocolSettings.Intelligence fanouts must satisfy MinFanout=%d <= Fanout=%d <= MaxFanout=%d",
+			withDefaults.MinFanout, withDefaults.Fanout, withDefaults.MaxFanout)
+	}
+	return nil
+}
+
+func (is *IntelligenceSettings) setDefaults() {
+	if is.MaxTtl == 0 {
+		is.MaxTtl = 5
+	}
+	if is.Ttl == 0 {
+		is.Ttl = 4
+	}
+	if is.RootTimeout == 0 {
+		is.RootTimeout = 10 * time.Second
+	}
+	if is.MaxParentTimeout == 0 {
+		is.MaxParentTimeout = 10 * time.Second
+	}
+	if is.ResponseMargin == 0 {
+		is.ResponseMargin = 500 * time.Millisecond
+	}
+	if is.MinForwardBudget == 0 {
+		is.MinForwardBudget = time.Second
+	}
+	if is.Fanout == 0 {
+		is.Fanout = 3
+	}
+	if is.FanoutDecay == 0 {
+		is.FanoutDecay = 1
+	}
+	if is.MinFanout == 0 {
+		is.MinFanout = 1
+	}
+	if is.MaxFanout == 0 {
+		is.MaxFanout = 3 * is.Fanout
+	}
+	if is.UnprocessedThreshold == 0 {
+		is.UnprocessedThreshold = 0.5
+	}
+	if is.ResponseCacheSize == 0 {
+		is.ResponseCacheSize = 1000
+	}
+	if is.MaxResponseCacheTtl == 0 {
+		is.MaxResponseCacheTtl = time.Hour
+	}
+	if is.TopicLookupTimeout == 0 {
+		is.TopicLookupTimeout = 2 * time.Second
+	}
 }
 
 // Addr constructs address from host and port
@@ -0,0 +1,30 @@
+package config
+
+import "testing"
+
+func TestIntelligenceSettingsValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings IntelligenceSettings
+		wantErr  bool
+	}{
+		{name: "defaults", settings: IntelligenceSettings{}},
+		{name: "valid fanouts", settings: IntelligenceSettings{Fanout: 4, MinFanout: 2, MaxFanout: 8, FanoutDecay: 0.5}},
+		{name: "negative fanout", settings: IntelligenceSettings{Fanout: -1}, wantErr: true},
+		{name: "decay above one", settings: IntelligenceSettings{FanoutDecay: 1.5}, wantErr: true},
+		{name: "negative decay", settings: IntelligenceSettings{FanoutDecay: -0.5}, wantErr: true},
+		{name: "threshold above one", settings: IntelligenceSettings{UnprocessedThreshold: 2}, wantErr: true},
+		{name: "min fanout above fanout", settings: IntelligenceSettings{Fanout: 2, MinFanout: 3}, wantErr: true},
+		{name: "fanout above max fanout", settings: IntelligenceSettings{Fanout: 5, MaxFanout: 4}, wantErr: true},
+		{name: "min fanout above default fanout", settings: IntelligenceSettings{MinFanout: 4}, wantErr: true},
+		{name: "max fanout defaults from fanout", settings: IntelligenceSettings{Fanout: 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.settings.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wanted error: %t", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
 	ma "github.com/multiformats/go-multiaddr"
+	"sync"
 	"time"
 
 	"happystoic/p2pnetwork/pkg/config"
@@ -16,6 +17,9 @@ import (
 
 var log = logging.Logger("iris")
 
+// DisconnectCallback is called when there is no connection to the peer left
+type DisconnectCallback func(p peer.ID)
+
 type RedisNotifyChange struct {
 	Peers []utils.PeerMetadata `json:"peers"`
 }
@@ -27,8 +31,12 @@ type Manager struct {
 	connecter *Connecter
 
 	orgSigProtocol *protocols.OrgSigProtocol
+	alertProtocol  *protocols.AlertProtocol
 	cfg            *config.Connections
 
+	callbacksLock       sync.Mutex
+	disconnectCallbacks []DisconnectCallback
+
 	ready bool
 }
 
@@ -48,13 +56,22 @@ func NewManager(cfg *config.Connections) (*Manager, error) {
 	return m, nil
 }
 
-func (m *Manager) SetDeps(pu *utils.ProtoUtils, os *protocols.OrgSigProtocol, c *Connecter) {
+func (m *Manager) SetDeps(pu *utils.ProtoUtils, os *protocols.OrgSigProtocol, ap *protocols.AlertProtocol, c *Connecter) {
 	m.ProtoUtils = pu
 	m.orgSigProtocol = os
+	m.alertProtocol = ap
 	m.connecter = c
 	m.ready = true
 }
 
+// SubscribeForDisconnect registers callback called whenever the last
+// connection to a peer is closed
+func (m *Manager) SubscribeForDisconnect(f DisconnectCallback) {
+	m.callbacksLock.Lock()
+	defer m.callbacksLock.Unlock()
+	m.disconnectCallbacks = append(m.disconnectCallbacks, f)
+}
+
 func (m *Manager) SetReliabilityTagCallback() reliability.Callback {
 	return func(p peer.ID, r reliability.Reliability) {
 		// TODO is this conversion precise enough?
@@ -82,6 +99,9 @@ func (m *Manager) connected(_ network.Network, c network.Conn) {
 	// exchange organisation signatures
 	m.orgSigProtocol.AskForOrgSignatures(c.RemotePeer())
 
+	// get recent alerts we missed while we were not connected
+	m.alertProtocol.RequestMissingAlerts(c.RemotePeer())
+
 	// notify TL about a change
 	m.notifyTL()
 }
@@ -89,6 +109,16 @@ func (m *Manager) connected(_ network.Network, c network.Conn) {
 func (m *Manager) disconnected(_ network.Network, c network.Conn) {
 	log.Debugf("disconnected from '%s'", c.RemotePeer())
 
+	// notify subscribers if this was the last connection to the peer
+	if m.Host.Network().Connectedness(c.RemotePeer()) != network.Connected {
+		m.callbacksLock.Lock()
+		callbacks := m.disconnectCallbacks
+		m.callbacksLock.Unlock()
+		for _, f := range callbacks {
+			f(c.RemotePeer())
+		}
+	}
+
 	// notify TL about a change
 	m.notifyTL()
 
@@ -35,14 +35,19 @@ func (ck *CryptoKit) AuthenticateMessage(message proto.Message, metadata *pb.Met
 	// restore sig in message data (for possible future use)
 	metadata.Signature = sign
 
+	return ck.VerifyData(metadata.OriginalSender, bin, sign)
+}
+
+// VerifyData verifies that data was signed by peer with given identity
+func (ck *CryptoKit) VerifyData(identity *pb.PeerIdentity, data []byte, sign []byte) error {
 	// restore node id binary format from base58 encoded node id data
-	peerId, err := peer.Decode(metadata.OriginalSender.NodeId)
+	peerId, err := peer.Decode(identity.NodeId)
 	if err != nil {
 		return err
 	}
 
 	// extract node id from the provided public key
-	key, err := libp2pcrypto.UnmarshalPublicKey(metadata.OriginalSender.NodePubKey)
+	key, err := libp2pcrypto.UnmarshalPublicKey(identity.NodePubKey)
 	if err != nil {
 		return err
 	}
@@ -53,10 +58,10 @@ func (ck *CryptoKit) AuthenticateMessage(message proto.Message, metadata *pb.Met
 
 	// verify that message author node id matches the provided node public key
 	if idFromKey != peerId {
-		return nil
+		return errors.New("node id does not match provided public key")
 	}
 
-	valid, err := key.Verify(bin, sign)
+	valid, err := key.Verify(data, sign)
 	if err != nil {
 		return err
 	}
@@ -72,6 +77,11 @@ func (ck *CryptoKit) SignProtoMessage(message proto.Message) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	return ck.SignData(data)
+}
+
+// SignData signs arbitrary data with private key of this peer
+func (ck *CryptoKit) SignData(data []byte) ([]byte, error) {
 	privateKey := ck.host.Peerstore().PrivKey(ck.host.ID())
 	return privateKey.Sign(data)
 }
@@ -2,17 +2,23 @@ package dht
 
 import (
 	"context"
+	"time"
 
 	"github.com/ipfs/go-cid"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/peer"
 	ipfsDht "github.com/libp2p/go-libp2p-kad-dht"
+	"github.com/libp2p/go-libp2p-kad-dht/providers"
+	"github.com/pkg/errors"
 )
 
 type Dht struct {
 	*ipfsDht.IpfsDHT
 
-	ctx context.Context
+	ctx       context.Context
+	providers *withdrawableProviders
 }
 
 func New(ctx context.Context, host host.Host, serverMode bool) (*Dht, error) {
@@ -20,16 +26,42 @@ func New(ctx context.Context, host host.Host, serverMode bool) (*Dht, error) {
 	if serverMode {
 		mode = ipfsDht.Mode(ipfsDht.ModeServer)
 	}
-	iDht, err := ipfsDht.New(ctx, host, ipfsDht.ProtocolPrefix("/iris"), mode)
-	return &Dht{iDht, ctx}, err
+	pm, err := providers.NewProviderManager(ctx, host.ID(), host.Peerstore(), dssync.MutexWrap(ds.NewMapDatastore()))
+	if err != nil {
+		return nil, err
+	}
+	wp := &withdrawableProviders{ProviderManager: pm, withdrawn: make(map[string]time.Time)}
+
+	iDht, err := ipfsDht.New(ctx, host, ipfsDht.ProtocolPrefix("/iris"), mode, ipfsDht.ProviderStore(wp),
+		ipfsDht.NamespacedValidator(feedNamespace, feedValidator{}))
+	return &Dht{iDht, ctx, wp}, err
 }
 
 func (d *Dht) StartProviding(cid cid.Cid) error {
+	if d.providers.isWithdrawn(cid.Hash()) {
+		return errors.Errorf("providing of %s was withdrawn", cid.String())
+	}
 	// TODO broadcast true or false? When true it returns error when no peers
 	//      are connected...
 	return d.Provide(d.ctx, cid, false)
 }
 
+// StopProviding withdraws the cid. Kademlia cannot remove provider records
+// already stored in other peers, but I stop providing the cid and answering
+// lookups for it, so the records expire in the network
+func (d *Dht) StopProviding(cid cid.Cid) {
+	d.providers.withdraw(cid.Hash())
+}
+
 func (d *Dht) GetProvidersOf(cid cid.Cid) ([]peer.AddrInfo, error) {
 	return d.FindProviders(d.ctx, cid)
 }
+
+// GetNProvidersOf returns at most n providers of cid found until ctx is done
+func (d *Dht) GetNProvidersOf(ctx context.Context, cid cid.Cid, n int) []peer.AddrInfo {
+	providers := make([]peer.AddrInfo, 0, n)
+	for p := range d.FindProvidersAsync(ctx, cid, n) {
+		providers = append(providers, p)
+	}
+	return providers
+}
@@ -0,0 +1,107 @@
+package dht
+
+import (
+	"context"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+
+	"happystoic/p2pnetwork/pkg/cryptotools"
+	"happystoic/p2pnetwork/pkg/messaging/pb"
+)
+
+// feedNamespace is namespace of DHT records with heads of feeds
+const feedNamespace = "iris-feed"
+
+// FeedKey returns DHT key under which head of the feed is stored
+func FeedKey(feed string) string {
+	return "/" + feedNamespace + "/" + feed
+}
+
+// ParseFeedHead decodes head of a feed stored under given DHT key. The head
+// must be signed by the author of the feed, and so must be the metadata of
+// the file if they are attached
+func ParseFeedHead(key string, value []byte) (*pb.FeedHead, error) {
+	head := &pb.FeedHead{}
+	if err := proto.Unmarshal(value, head); err != nil {
+		return nil, errors.WithMessage(err, "error decoding feed head: ")
+	}
+	if FeedKey(head.Feed) != key {
+		return nil, errors.Errorf("head of feed %s stored under key %s", head.Feed, key)
+	}
+	if head.Metadata == nil || head.Metadata.OriginalSender == nil {
+		return nil, errors.New("feed head has no author")
+	}
+	author := head.Metadata.OriginalSender.NodeId
+	if !strings.HasPrefix(head.Feed, author+"/") {
+		return nil, errors.Errorf("head of feed %s signed by %s who is not its author", head.Feed, author)
+	}
+	// signatures are verified with the public key in the message, so the
+	// crypto kit does not need a host
+	ck := cryptotools.NewCryptoKit(nil)
+	if err := ck.AuthenticateMessage(head, head.Metadata); err != nil {
+		return nil, errors.WithMessage(err, "error authenticating feed head: ")
+	}
+
+	meta := head.FileMetadata
+	if meta == nil {
+		return head, nil
+	}
+	if meta.Metadata == nil || meta.Metadata.OriginalSender == nil || meta.Metadata.OriginalSender.NodeId != author {
+		return nil, errors.Errorf("metadata in head of feed %s are not signed by its author", head.Feed)
+	}
+	if meta.Cid != head.Cid || meta.Feed != head.Feed || meta.Version != head.Sequence {
+		return nil, errors.Errorf("metadata in head of feed %s describe another version", head.Feed)
+	}
+	if err := ck.AuthenticateMessage(meta, meta.Metadata); err != nil {
+		return nil, errors.WithMessage(err, "error authenticating metadata in feed head: ")
+	}
+	return head, nil
+}
+
+// feedValidator accepts only heads of feeds signed by their authors and
+// selects the one with the highest sequence number
+type feedValidator struct{}
+
+func (feedValidator) Validate(key string, value []byte) error {
+	_, err := ParseFeedHead(key, value)
+	return err
+}
+
+func (feedValidator) Select(key string, values [][]byte) (int, error) {
+	best := -1
+	var bestSequence uint64
+	for i, value := range values {
+		head, err := ParseFeedHead(key, value)
+		if err != nil {
+			continue
+		}
+		if best == -1 || head.Sequence > bestSequence {
+			best, bestSequence = i, head.Sequence
+		}
+	}
+	if best == -1 {
+		return 0, errors.Errorf("no valid head of feed under key %s", key)
+	}
+	return best, nil
+}
+
+// PutFeedHead stores signed head of the feed in DHT
+func (d *Dht) PutFeedHead(head *pb.FeedHead) error {
+	value, err := proto.Marshal(head)
+	if err != nil {
+		return err
+	}
+	return d.PutValue(d.ctx, FeedKey(head.Feed), value)
+}
+
+// GetFeedHead resolves the latest head of the feed in DHT
+func (d *Dht) GetFeedHead(ctx context.Context, feed string) (*pb.FeedHead, error) {
+	key := FeedKey(feed)
+	value, err := d.GetValue(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFeedHead(key, value)
+}
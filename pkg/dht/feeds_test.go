@@ -0,0 +1,93 @@
+package dht
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+
+	"happystoic/p2pnetwork/pkg/messaging/pb"
+)
+
+type testAuthor struct {
+	key      crypto.PrivKey
+	identity *pb.PeerIdentity
+}
+
+func newTestAuthor(t *testing.T) *testAuthor {
+	key, pub, err := crypto.GenerateEd25519Key(rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %s", err)
+	}
+	id, err := peer.IDFromPublicKey(pub)
+	if err != nil {
+		t.Fatalf("error deriving peer id: %s", err)
+	}
+	pubBytes, err := crypto.MarshalPublicKey(pub)
+	if err != nil {
+		t.Fatalf("error marshalling public key: %s", err)
+	}
+	return &testAuthor{key: key, identity: &pb.PeerIdentity{NodeId: id.String(), NodePubKey: pubBytes}}
+}
+
+// head returns serialized feed head signed by the author
+func (a *testAuthor) head(t *testing.T, feed string, sequence uint64) []byte {
+	head := &pb.FeedHead{
+		Metadata: &pb.MetaData{OriginalSender: a.identity},
+		Feed:     feed,
+		Sequence: sequence,
+		Cid:      "QmS4FkBx1uBDHDLASvDocmfo5FXrXgNv4F8WRDkiNTUFe7",
+	}
+	data, err := proto.Marshal(head)
+	if err != nil {
+		t.Fatalf("error marshalling feed head: %s", err)
+	}
+	head.Metadata.Signature, err = a.key.Sign(data)
+	if err != nil {
+		t.Fatalf("error signing feed head: %s", err)
+	}
+	data, err = proto.Marshal(head)
+	if err != nil {
+		t.Fatalf("error marshalling feed head: %s", err)
+	}
+	return data
+}
+
+func TestFeedValidator(t *testing.T) {
+	author, other := newTestAuthor(t), newTestAuthor(t)
+	feed := author.identity.NodeId + "/blocklist"
+	valid := author.head(t, feed, 2)
+	tampered := author.head(t, feed, 3)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name    string
+		key     string
+		value   []byte
+		wantErr bool
+	}{
+		{name: "signed by author", key: FeedKey(feed), value: valid},
+		{name: "stored under another key", key: FeedKey(feed + "2"), value: valid, wantErr: true},
+		{name: "signed by another peer", key: FeedKey(feed), value: other.head(t, feed, 5), wantErr: true},
+		{name: "tampered", key: FeedKey(feed), value: tampered, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := feedValidator{}.Validate(tt.key, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wanted error: %t", err, tt.wantErr)
+			}
+		})
+	}
+
+	values := [][]byte{valid, other.head(t, feed, 5), author.head(t, feed, 4), tampered}
+	best, err := feedValidator{}.Select(FeedKey(feed), values)
+	if err != nil {
+		t.Fatalf("error selecting feed head: %s", err)
+	}
+	if best != 2 {
+		t.Fatalf("selected head %d, expected valid head with the highest sequence", best)
+	}
+}
@@ -0,0 +1,57 @@
+package dht
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-kad-dht/providers"
+)
+
+// withdrawableProviders is provider store which forgets withdrawn keys. It
+// neither stores new provider records of them nor answers lookups for them,
+// so withdrawn content stops being provided by me and through me
+type withdrawableProviders struct {
+	*providers.ProviderManager
+
+	lock      sync.Mutex
+	withdrawn map[string]time.Time
+}
+
+func (wp *withdrawableProviders) withdraw(key []byte) {
+	wp.lock.Lock()
+	defer wp.lock.Unlock()
+
+	// records announced to other peers expire after ProvideValidity, so
+	// the key does not have to be remembered longer
+	now := time.Now()
+	for k, at := range wp.withdrawn {
+		if now.Sub(at) > providers.ProvideValidity {
+			delete(wp.withdrawn, k)
+		}
+	}
+	wp.withdrawn[string(key)] = now
+}
+
+func (wp *withdrawableProviders) isWithdrawn(key []byte) bool {
+	wp.lock.Lock()
+	defer wp.lock.Unlock()
+
+	_, withdrawn := wp.withdrawn[string(key)]
+	return withdrawn
+}
+
+func (wp *withdrawableProviders) AddProvider(ctx context.Context, key []byte, prov peer.AddrInfo) error {
+	if wp.isWithdrawn(key) {
+		return nil
+	}
+	return wp.ProviderManager.AddProvider(ctx, key, prov)
+}
+
+func (wp *withdrawableProviders) GetProviders(ctx context.Context, key []byte) ([]peer.AddrInfo, error) {
+	if wp.isWithdrawn(key) {
+		return nil, nil
+	}
+	return wp.ProviderManager.GetProviders(ctx, key)
+}
@@ -0,0 +1,73 @@
+package files
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/ipfs/go-cid"
+)
+
+// CidHasher computes cid of data written into it, so cid of large files can
+// be computed without loading them whole into memory
+type CidHasher struct {
+	hash.Hash
+}
+
+func NewCidHasher() *CidHasher {
+	return &CidHasher{sha256.New()}
+}
+
+// Cid returns cid of all data written so far
+func (h *CidHasher) Cid() (*cid.Cid, error) {
+	// CIDv0 is sha2-256 multihash - code 0x12, digest length 0x20 and digest
+	c, err := cid.Cast(append([]byte{0x12, 0x20}, h.Sum(nil)...))
+	return &c, err
+}
+
+// ChunkHash returns hash of one chunk of a file
+func ChunkHash(data []byte) []byte {
+	h := sha256.Sum256(data)
+	return h[:]
+}
+
+// ChunkHashes reads file and returns its size and hashes of all its chunks
+func ChunkHashes(path string, chunkSize int64) (int64, [][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var size int64
+	hashes := make([][]byte, 0)
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			hashes = append(hashes, ChunkHash(buf[:n]))
+			size += int64(n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return size, hashes, nil
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+}
+
+// ChunksRoot returns hash of all chunk hashes. It is signed by the author of
+// the file, so hashes of chunks received from any provider can be verified
+func ChunksRoot(hashes [][]byte) []byte {
+	return ChunkHash(bytes.Join(hashes, nil))
+}
+
+// NumberOfChunks returns how many chunks file of given size has
+func NumberOfChunks(size, chunkSize int64) int {
+	return int((size + chunkSize - 1) / chunkSize)
+}
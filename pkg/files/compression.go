@@ -0,0 +1,103 @@
+package files
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+// supported compressions of transferred file chunks
+const (
+	Zstd = "zstd"
+	Gzip = "gzip"
+)
+
+// zstd encoder is created lazily and shared, it is safe for concurrent use
+// of EncodeAll
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdErr     error
+)
+
+func getZstdEncoder() (*zstd.Encoder, error) {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil)
+	})
+	return zstdEncoder, zstdErr
+}
+
+// UsableCompressions returns given compressions without those which cannot
+// be used, so they are not negotiated with other peers
+func UsableCompressions(compressions []string) []string {
+	usable := make([]string, 0, len(compressions))
+	for _, c := range compressions {
+		if c == Zstd {
+			if _, err := getZstdEncoder(); err != nil {
+				log.Errorf("disabling zstd compression, error creating encoder: %s", err)
+				continue
+			}
+		}
+		usable = append(usable, c)
+	}
+	return usable
+}
+
+// Compress compresses data with given compression
+func Compress(compression string, data []byte) ([]byte, error) {
+	switch compression {
+	case Zstd:
+		encoder, err := getZstdEncoder()
+		if err != nil {
+			return nil, err
+		}
+		return encoder.EncodeAll(data, nil), nil
+	case Gzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, errors.Errorf("unknown compression %s", compression)
+}
+
+// Decompress decompresses data with given compression. Data decompressed to
+// more than maxSize bytes are refused, so a peer cannot send compression bomb
+func Decompress(compression string, data []byte, maxSize int64) ([]byte, error) {
+	var r io.Reader
+	switch compression {
+	case Zstd:
+		d, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer d.Close()
+		r = d
+	case Gzip:
+		g, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		r = g
+	default:
+		return nil, errors.Errorf("unknown compression %s", compression)
+	}
+
+	out, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(out)) > maxSize {
+		return nil, errors.Errorf("decompressed data exceed %d bytes", maxSize)
+	}
+	return out, nil
+}
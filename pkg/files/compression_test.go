@@ -0,0 +1,77 @@
+package files
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	random := make([]byte, 64<<10)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "empty", data: []byte{}},
+		{name: "repetitive", data: bytes.Repeat([]byte("192.168.1.1\n"), 10000)},
+		{name: "random", data: random},
+	}
+	for _, compression := range []string{Zstd, Gzip} {
+		for _, tt := range tests {
+			t.Run(compression+"/"+tt.name, func(t *testing.T) {
+				compressed, err := Compress(compression, tt.data)
+				if err != nil {
+					t.Fatalf("error compressing: %s", err)
+				}
+				out, err := Decompress(compression, compressed, int64(len(tt.data)))
+				if err != nil {
+					t.Fatalf("error decompressing: %s", err)
+				}
+				if !bytes.Equal(out, tt.data) {
+					t.Fatalf("decompressed data differ from the original")
+				}
+			})
+		}
+	}
+}
+
+func TestDecompressSizeLimit(t *testing.T) {
+	data := bytes.Repeat([]byte{0}, 1<<20)
+	tests := []struct {
+		name    string
+		maxSize int64
+		wantErr bool
+	}{
+		{name: "exactly max size", maxSize: int64(len(data))},
+		{name: "one byte over max size", maxSize: int64(len(data)) - 1, wantErr: true},
+		{name: "compression bomb", maxSize: 1 << 10, wantErr: true},
+	}
+	for _, compression := range []string{Zstd, Gzip} {
+		compressed, err := Compress(compression, data)
+		if err != nil {
+			t.Fatalf("error compressing: %s", err)
+		}
+		for _, tt := range tests {
+			t.Run(compression+"/"+tt.name, func(t *testing.T) {
+				_, err := Decompress(compression, compressed, tt.maxSize)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("got error %v, wanted error: %t", err, tt.wantErr)
+				}
+			})
+		}
+	}
+}
+
+func TestUnknownCompression(t *testing.T) {
+	if _, err := Compress("lz4", []byte("data")); err == nil {
+		t.Fatal("unknown compression was accepted by Compress")
+	}
+	if _, err := Decompress("lz4", []byte("data"), 4); err == nil {
+		t.Fatal("unknown compression was accepted by Decompress")
+	}
+	if got := UsableCompressions([]string{Zstd, Gzip}); len(got) != 2 {
+		t.Fatalf("got usable compressions %v, expected zstd and gzip", got)
+	}
+}
@@ -0,0 +1,120 @@
+package files
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+)
+
+// WeakHash returns rsync rolling checksum of a chunk. It is cheap to compute
+// for every position in a file, but it must be confirmed by ChunkHash
+func WeakHash(data []byte) uint32 {
+	var a, b uint32
+	l := uint32(len(data))
+	for i, x := range data {
+		a += uint32(x)
+		b += (l - uint32(i)) * uint32(x)
+	}
+	return a&0xffff | b<<16
+}
+
+// WeakChunkHashes reads file and returns weak hashes of all its chunks
+func WeakChunkHashes(path string, chunkSize int64) ([]uint32, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	hashes := make([]uint32, 0)
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			hashes = append(hashes, WeakHash(buf[:n]))
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return hashes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// FindChunks searches the file for wanted chunks of another file, which are
+// described by their weak and strong hashes. Every position of the file is
+// checked with rolling weak hash, so also shifted chunks are found. It returns
+// offsets of found chunks in the file. Only chunks of full chunk size can be
+// found, the shorter last chunk of a file must be checked by the caller
+func FindChunks(path string, chunkSize int64, weak []uint32, strong [][]byte, wanted []uint32) (map[uint32]int64, error) {
+	found := make(map[uint32]int64)
+	candidates := make(map[uint32][]uint32)
+	for _, index := range wanted {
+		candidates[weak[index]] = append(candidates[weak[index]], index)
+	}
+	if len(candidates) == 0 {
+		return found, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	r := bufio.NewReader(f)
+
+	// window is ring buffer with the last chunkSize bytes of the file
+	window := make([]byte, chunkSize)
+	if _, err = io.ReadFull(r, window); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return found, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var a, b uint32
+	for i, x := range window {
+		a += uint32(x)
+		b += (uint32(chunkSize) - uint32(i)) * uint32(x)
+	}
+
+	start, offset := 0, int64(0)
+	for len(candidates) > 0 {
+		weakHash := a&0xffff | b<<16
+		if indexes, ok := candidates[weakHash]; ok {
+			hash := ChunkHash(append(append(make([]byte, 0, chunkSize), window[start:]...), window[:start]...))
+			remaining := indexes[:0]
+			for _, index := range indexes {
+				if bytes.Equal(hash, strong[index]) {
+					found[index] = offset
+				} else {
+					remaining = append(remaining, index)
+				}
+			}
+			if len(remaining) == 0 {
+				delete(candidates, weakHash)
+			} else {
+				candidates[weakHash] = remaining
+			}
+		}
+
+		// roll the window by one byte
+		in, err := r.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		out := window[start]
+		window[start] = in
+		start = (start + 1) % len(window)
+		offset++
+		a += uint32(in) - uint32(out)
+		b += a - uint32(chunkSize)*uint32(out)
+	}
+	return found, nil
+}
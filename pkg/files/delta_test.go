@@ -0,0 +1,121 @@
+package files
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testChunkSize = 64
+
+// writeTestFile writes data into a temporary file and returns its path
+func writeTestFile(t *testing.T, data []byte) string {
+	path := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("error writing test file: %s", err)
+	}
+	return path
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+// testChunks returns weak and strong hashes of chunks of data
+func testChunks(data []byte) ([]uint32, [][]byte) {
+	weak := make([]uint32, 0)
+	strong := make([][]byte, 0)
+	for i := 0; i < len(data); i += testChunkSize {
+		end := i + testChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		weak = append(weak, WeakHash(data[i:end]))
+		strong = append(strong, ChunkHash(data[i:end]))
+	}
+	return weak, strong
+}
+
+func TestWeakChunkHashes(t *testing.T) {
+	data := make([]byte, 3*testChunkSize+10)
+	rand.New(rand.NewSource(1)).Read(data)
+	expected, _ := testChunks(data)
+
+	weak, err := WeakChunkHashes(writeTestFile(t, data), testChunkSize)
+	if err != nil {
+		t.Fatalf("error computing weak hashes: %s", err)
+	}
+	if len(weak) != len(expected) {
+		t.Fatalf("got %d weak hashes, expected %d", len(weak), len(expected))
+	}
+	for i := range weak {
+		if weak[i] != expected[i] {
+			t.Fatalf("weak hash of chunk %d differs", i)
+		}
+	}
+}
+
+func TestFindChunks(t *testing.T) {
+	original := make([]byte, 8*testChunkSize)
+	rand.New(rand.NewSource(1)).Read(original)
+	allChunks := []uint32{0, 1, 2, 3, 4, 5, 6, 7}
+
+	tests := []struct {
+		name   string
+		base   []byte
+		wanted []uint32
+		// expected offsets of found chunks in the base file
+		expected map[uint32]int64
+	}{
+		{
+			name:     "identical file",
+			base:     original,
+			wanted:   []uint32{1, 6},
+			expected: map[uint32]int64{1: testChunkSize, 6: 6 * testChunkSize},
+		},
+		{
+			name:   "chunks shifted by inserted line",
+			base:   concat(original[:4*testChunkSize], []byte("inserted line\n"), original[4*testChunkSize:]),
+			wanted: allChunks,
+			expected: map[uint32]int64{0: 0, 1: testChunkSize, 2: 2 * testChunkSize, 3: 3 * testChunkSize,
+				4: 4*testChunkSize + 14, 5: 5*testChunkSize + 14, 6: 6*testChunkSize + 14, 7: 7*testChunkSize + 14},
+		},
+		{
+			name:     "changed chunk is not found",
+			base:     concat(original[:2*testChunkSize], bytes.Repeat([]byte{1}, testChunkSize), original[3*testChunkSize:]),
+			wanted:   []uint32{1, 2, 3},
+			expected: map[uint32]int64{1: testChunkSize, 3: 3 * testChunkSize},
+		},
+		{
+			name:     "base shorter than chunk",
+			base:     original[:testChunkSize-1],
+			wanted:   allChunks,
+			expected: map[uint32]int64{},
+		},
+		{
+			name:     "nothing wanted",
+			base:     original,
+			wanted:   []uint32{},
+			expected: map[uint32]int64{},
+		},
+	}
+	weak, strong := testChunks(original)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := FindChunks(writeTestFile(t, tt.base), testChunkSize, weak, strong, tt.wanted)
+			if err != nil {
+				t.Fatalf("error finding chunks: %s", err)
+			}
+			if len(found) != len(tt.expected) {
+				t.Fatalf("found %d chunks %v, expected %d %v", len(found), found, len(tt.expected), tt.expected)
+			}
+			for index, offset := range tt.expected {
+				if got, ok := found[index]; !ok || got != offset {
+					t.Fatalf("chunk %d found at %d (found: %t), expected at %d", index, got, ok, offset)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+package files
+
+import "syscall"
+
+// FreeDiskSpace returns number of bytes available to unprivileged users on the
+// filesystem of dir
+func FreeDiskSpace(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
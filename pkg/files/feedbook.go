@@ -0,0 +1,68 @@
+package files
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/pkg/errors"
+)
+
+// FeedVersion is one version of a feed. Feed is mutable identifier of its
+// author which points to the latest version of a shared file (e.g. blocklist)
+type FeedVersion struct {
+	Version uint64
+	Cid     cid.Cid
+}
+
+// FeedId returns identifier of author's feed with given name. The author is
+// part of the identifier, so only the author can publish new versions
+func FeedId(author peer.ID, name string) string {
+	return author.String() + "/" + name
+}
+
+// ParseFeedId returns author and name of the feed
+func ParseFeedId(feed string) (peer.ID, string, error) {
+	parts := strings.SplitN(feed, "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", "", errors.Errorf("invalid feed id %s", feed)
+	}
+	author, err := peer.Decode(parts[0])
+	if err != nil {
+		return "", "", errors.WithMessage(err, "error decoding author of feed: ")
+	}
+	return author, parts[1], nil
+}
+
+// FeedBook keeps the latest known version of every feed
+type FeedBook struct {
+	lock  sync.Mutex
+	feeds map[string]FeedVersion
+}
+
+func NewFeedBook() *FeedBook {
+	return &FeedBook{feeds: make(map[string]FeedVersion)}
+}
+
+// Latest returns the latest known version of the feed
+func (fb *FeedBook) Latest(feed string) (FeedVersion, bool) {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+
+	v, exists := fb.feeds[feed]
+	return v, exists
+}
+
+// Update stores version of the feed if it is newer than the latest known
+// one. It returns false if the version is not newer
+func (fb *FeedBook) Update(feed string, v FeedVersion) bool {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+
+	if latest, exists := fb.feeds[feed]; exists && latest.Version >= v.Version {
+		return false
+	}
+	fb.feeds[feed] = v
+	return true
+}
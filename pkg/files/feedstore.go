@@ -0,0 +1,113 @@
+package files
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// FeedState is persisted state of one feed of this peer
+type FeedState struct {
+	// Sequence is the last version of the feed, it never decreases
+	Sequence uint64 `json:"sequence"`
+	Cid      string `json:"cid"`
+	// Head is serialized signed head of the feed, it is republished in DHT
+	Head []byte `json:"head"`
+}
+
+// FeedStore persists state of feeds of this peer by their names, so their
+// versions keep increasing and point to previous versions also after restart
+type FeedStore struct {
+	lock  sync.Mutex
+	path  string
+	feeds map[string]FeedState
+}
+
+// LoadFeedStore loads feeds stored in file at path. Missing file is treated
+// as no feeds
+func LoadFeedStore(path string) (*FeedStore, error) {
+	fs := &FeedStore{path: path, feeds: make(map[string]FeedState)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &fs.feeds); err != nil {
+		return nil, errors.WithMessage(err, "error decoding feed store: ")
+	}
+	return fs, nil
+}
+
+// Get returns state of the feed with given name
+func (fs *FeedStore) Get(name string) (FeedState, bool) {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	state, exists := fs.feeds[name]
+	return state, exists
+}
+
+// All returns state of all feeds by their names
+func (fs *FeedStore) All() map[string]FeedState {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	all := make(map[string]FeedState, len(fs.feeds))
+	for name, state := range fs.feeds {
+		all[name] = state
+	}
+	return all
+}
+
+// Set stores state of the feed and persists the store. Sequence of the feed
+// must increase unless only its head is updated. Nothing is changed when the
+// store cannot be persisted
+func (fs *FeedStore) Set(name string, state FeedState) error {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+
+	old, exists := fs.feeds[name]
+	if exists && (state.Sequence < old.Sequence || state.Sequence == old.Sequence && state.Cid != old.Cid) {
+		return errors.Errorf("sequence %d of feed %s is not newer than %d", state.Sequence, name, old.Sequence)
+	}
+	fs.feeds[name] = state
+	if err := fs.save(); err != nil {
+		if exists {
+			fs.feeds[name] = old
+		} else {
+			delete(fs.feeds, name)
+		}
+		return err
+	}
+	return nil
+}
+
+// save atomically replaces the file with current state. Lock must be held
+func (fs *FeedStore) save() error {
+	data, err := json.Marshal(fs.feeds)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(fs.path), filepath.Base(fs.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), fs.path)
+}
@@ -0,0 +1,57 @@
+package files
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFeedStorePersistsSequence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feeds.json")
+	store, err := LoadFeedStore(path)
+	if err != nil {
+		t.Fatalf("error loading empty feed store: %s", err)
+	}
+	if err = store.Set("blocklist", FeedState{Sequence: 1, Cid: "first"}); err != nil {
+		t.Fatalf("error setting feed: %s", err)
+	}
+	if err = store.Set("blocklist", FeedState{Sequence: 2, Cid: "second"}); err != nil {
+		t.Fatalf("error setting feed: %s", err)
+	}
+
+	tests := []struct {
+		name    string
+		state   FeedState
+		wantErr bool
+	}{
+		{name: "older sequence", state: FeedState{Sequence: 1, Cid: "first"}, wantErr: true},
+		{name: "same sequence of another file", state: FeedState{Sequence: 2, Cid: "other"}, wantErr: true},
+		{name: "same sequence with head", state: FeedState{Sequence: 2, Cid: "second", Head: []byte("head")}},
+		{name: "newer sequence", state: FeedState{Sequence: 3, Cid: "third"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// every change must survive restart of the node
+			store, err := LoadFeedStore(path)
+			if err != nil {
+				t.Fatalf("error loading feed store: %s", err)
+			}
+			before, _ := store.Get("blocklist")
+			err = store.Set("blocklist", tt.state)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wanted error: %t", err, tt.wantErr)
+			}
+
+			reloaded, err := LoadFeedStore(path)
+			if err != nil {
+				t.Fatalf("error reloading feed store: %s", err)
+			}
+			expected := tt.state
+			if tt.wantErr {
+				expected = before
+			}
+			if state, _ := reloaded.Get("blocklist"); state.Sequence != expected.Sequence || state.Cid != expected.Cid {
+				t.Fatalf("reloaded feed %+v, expected %+v", state, expected)
+			}
+		})
+	}
+}
@@ -1,27 +1,80 @@
 package files
 
 import (
-	"bufio"
-	"io/ioutil"
+	"context"
+	"io"
 	"os"
+	"sort"
+	"sync"
 	"time"
 
+	logging "github.com/ipfs/go-log/v2"
+
 	"github.com/ipfs/go-cid"
 	"github.com/pkg/errors"
 
 	"happystoic/p2pnetwork/pkg/org"
 )
 
+var log = logging.Logger("iris")
+
 type FileMeta struct {
 	ExpiredAt time.Time
 	Expired   bool
 
 	Available bool
 	Path      string
+	// Downloaded is true when the file was downloaded from other peers
+	// into the download directory (and is not original file of TL)
+	Downloaded bool
+	// LastUsed is time when the file was last downloaded, served or requested
+	LastUsed time.Time
 
 	Rights      []*org.Org
 	Severity    Severity
 	Description interface{}
+
+	// Size of the file and hashes of its chunks. ChunksRoot is signed by the
+	// author of the file, ChunkHashes are known only when the file is available
+	Size        int64
+	ChunkSize   int64
+	ChunksRoot  []byte
+	ChunkHashes [][]byte
+	// WeakHashes are rolling checksums of chunks, computed when requested
+	WeakHashes []uint32
+
+	// ProviderKey is secret of files with rights, known only to peers who
+	// received the metadata. Providers are announced under key derived from it
+	ProviderKey []byte
+
+	// Feed, Version and PreviousCid are set if the file is version of a feed
+	Feed        string
+	Version     uint64
+	PreviousCid cid.Cid
+}
+
+// IsExpired tells whether ExpiredAt of the file elapsed. Expired flag is set
+// only periodically by the janitor, so the time is checked directly
+func (m *FileMeta) IsExpired() bool {
+	return m.Expired || time.Now().After(m.ExpiredAt)
+}
+
+// ProviderCid returns cid under which providers of the file are announced in
+// DHT. Providers of files with ProviderKey are announced under cid derived
+// from the key, so peers who do not know it cannot learn who holds the file
+func ProviderCid(fileCid cid.Cid, meta *FileMeta) (cid.Cid, error) {
+	if len(meta.ProviderKey) == 0 {
+		return fileCid, nil
+	}
+	h := NewCidHasher()
+	_, _ = h.Write([]byte("iris-file-providers/"))
+	_, _ = h.Write(meta.ProviderKey)
+	_, _ = h.Write(fileCid.Bytes())
+	c, err := h.Cid()
+	if err != nil {
+		return cid.Undef, err
+	}
+	return *c, nil
 }
 
 func GetFileCid(path string) (*cid.Cid, error) {
@@ -32,13 +85,13 @@ func GetFileCid(path string) (*cid.Cid, error) {
 	defer func() {
 		_ = f.Close()
 	}()
-	reader := bufio.NewReader(f)
-	data, err := ioutil.ReadAll(reader)
-	if err != nil {
+
+	// hash the file by parts, so it does not have to fit into memory
+	h := NewCidHasher()
+	if _, err = io.Copy(h, f); err != nil {
 		return nil, err
 	}
-
-	return GetBytesCid(data)
+	return h.Cid()
 }
 
 func GetBytesCid(data []byte) (*cid.Cid, error) {
@@ -47,7 +100,11 @@ func GetBytesCid(data []byte) (*cid.Cid, error) {
 	return &c, err
 }
 
+// ExpirationCallback is called with every file whose ExpiredAt elapsed
+type ExpirationCallback func(cid.Cid, *FileMeta)
+
 type FileBook struct {
+	lock  sync.Mutex
 	files map[cid.Cid]*FileMeta
 }
 
@@ -56,6 +113,9 @@ func NewFileBook() *FileBook {
 }
 
 func (fb *FileBook) Get(cid *cid.Cid) *FileMeta {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+
 	if meta, exists := fb.files[*cid]; exists {
 		return meta
 	}
@@ -63,9 +123,159 @@ func (fb *FileBook) Get(cid *cid.Cid) *FileMeta {
 }
 
 func (fb *FileBook) AddFile(cid *cid.Cid, meta *FileMeta) error {
-	if _, exists := fb.files[*cid]; exists {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+
+	old, exists := fb.files[*cid]
+	if exists && !old.Expired {
 		return errors.Errorf("file with cid %s already exists", cid.String())
 	}
+	if exists && old.Downloaded && old.Available && !meta.Available && old.ChunkSize == meta.ChunkSize {
+		// file was announced again, its copy kept after expiration is valid
+		meta.Available = true
+		meta.Downloaded = true
+		meta.Path = old.Path
+		meta.LastUsed = old.LastUsed
+		meta.ChunkHashes = old.ChunkHashes
+		meta.WeakHashes = old.WeakHashes
+	}
 	fb.files[*cid] = meta
 	return nil
 }
+
+// Remove deletes metadata of the file from the book
+func (fb *FileBook) Remove(cid *cid.Cid) {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+
+	delete(fb.files, *cid)
+}
+
+// Snapshot returns copy of metadata of the file, so it can be read while the
+// metadata are being changed by other goroutines
+func (fb *FileBook) Snapshot(cid *cid.Cid) *FileMeta {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+
+	if meta, exists := fb.files[*cid]; exists {
+		snapshot := *meta
+		return &snapshot
+	}
+	return nil
+}
+
+// SetDownloaded marks the file as downloaded to path and stores verified
+// hashes of its chunks
+func (fb *FileBook) SetDownloaded(cid *cid.Cid, path string, chunkHashes [][]byte) {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+
+	if meta, exists := fb.files[*cid]; exists {
+		meta.Available = true
+		meta.Downloaded = true
+		meta.Path = path
+		meta.ChunkHashes = chunkHashes
+		meta.LastUsed = time.Now()
+	}
+}
+
+// SetUnavailable marks downloaded copy of the file as deleted
+func (fb *FileBook) SetUnavailable(cid *cid.Cid) {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+
+	if meta, exists := fb.files[*cid]; exists {
+		meta.Available = false
+		meta.Downloaded = false
+		meta.Path = ""
+	}
+}
+
+// SetWeakHashes stores weak hashes of chunks of the file
+func (fb *FileBook) SetWeakHashes(cid *cid.Cid, weak []uint32) {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+
+	if meta, exists := fb.files[*cid]; exists {
+		meta.WeakHashes = weak
+	}
+}
+
+// Touch marks the file as just used
+func (fb *FileBook) Touch(cid *cid.Cid) {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+
+	if meta, exists := fb.files[*cid]; exists {
+		meta.LastUsed = time.Now()
+	}
+}
+
+// DownloadedFiles returns cids of available downloaded files sorted from the
+// expired ones and then from the least recently used one
+func (fb *FileBook) DownloadedFiles() []cid.Cid {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+
+	cids := make([]cid.Cid, 0)
+	for c, meta := range fb.files {
+		if meta.Downloaded && meta.Available {
+			cids = append(cids, c)
+		}
+	}
+	sort.Slice(cids, func(i, j int) bool {
+		a, b := fb.files[cids[i]], fb.files[cids[j]]
+		if a.Expired != b.Expired {
+			return a.Expired
+		}
+		return a.LastUsed.Before(b.LastUsed)
+	})
+	return cids
+}
+
+// RunJanitor periodically marks files expired when their ExpiredAt elapses
+// and purges their metadata. onExpired is called with copy of metadata of
+// every file which expired while being in the book
+func (fb *FileBook) RunJanitor(ctx context.Context, every time.Duration, onExpired ExpirationCallback) {
+	go func() {
+		ticker := time.NewTicker(every)
+		for {
+			select {
+			case <-ctx.Done():
+				ticker.Stop()
+				log.Infof("stoping file book janitor: %s", ctx.Err())
+				return
+			case <-ticker.C:
+				for c, meta := range fb.purgeExpired(time.Now()) {
+					log.Infof("file %s expired at %s", c.String(), meta.ExpiredAt)
+					onExpired(c, meta)
+				}
+			}
+		}
+	}()
+}
+
+// purgeExpired removes metadata of files expired before now and returns copy
+// of those which were not already known to be expired. Downloaded files still
+// kept on disk stay in the book as expired, so they are counted into the
+// quota and can be evicted later
+func (fb *FileBook) purgeExpired(now time.Time) map[cid.Cid]*FileMeta {
+	fb.lock.Lock()
+	defer fb.lock.Unlock()
+
+	expired := make(map[cid.Cid]*FileMeta)
+	for c, meta := range fb.files {
+		if !now.After(meta.ExpiredAt) {
+			continue
+		}
+		if !meta.Expired {
+			meta.Expired = true
+			snapshot := *meta
+			expired[c] = &snapshot
+		}
+		if !meta.Downloaded || !meta.Available {
+			delete(fb.files, c)
+		}
+	}
+	return expired
+}
@@ -0,0 +1,89 @@
+package files
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPurgeExpired(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		meta *FileMeta
+		// whether the file is reported as newly expired and kept in the book
+		reported bool
+		kept     bool
+	}{
+		{
+			name: "not expired",
+			meta: &FileMeta{ExpiredAt: now.Add(time.Hour)},
+			kept: true,
+		},
+		{
+			name:     "expired metadata",
+			meta:     &FileMeta{ExpiredAt: now.Add(-time.Hour)},
+			reported: true,
+		},
+		{
+			name: "expired downloaded file",
+			meta: &FileMeta{ExpiredAt: now.Add(-time.Hour), Downloaded: true, Available: true,
+				Path: "/tmp/file"},
+			reported: true,
+			kept:     true,
+		},
+		{
+			name: "already known expired file",
+			meta: &FileMeta{ExpiredAt: now.Add(-time.Hour), Expired: true, Downloaded: true,
+				Available: true, Path: "/tmp/file"},
+			kept: true,
+		},
+		{
+			name:     "evicted expired file",
+			meta:     &FileMeta{ExpiredAt: now.Add(-time.Hour), Expired: true, Downloaded: false},
+			reported: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fb := NewFileBook()
+			c, err := GetBytesCid([]byte(tt.name))
+			if err != nil {
+				t.Fatalf("error computing cid: %s", err)
+			}
+			if err = fb.AddFile(c, tt.meta); err != nil {
+				t.Fatalf("error adding file: %s", err)
+			}
+
+			expired := fb.purgeExpired(now)
+			if _, reported := expired[*c]; reported != tt.reported {
+				t.Fatalf("file reported as expired: %t, expected %t", reported, tt.reported)
+			}
+			if kept := fb.Get(c) != nil; kept != tt.kept {
+				t.Fatalf("file kept in the book: %t, expected %t", kept, tt.kept)
+			}
+		})
+	}
+}
+
+func TestAddFileReplacesExpired(t *testing.T) {
+	now := time.Now()
+	fb := NewFileBook()
+	c, err := GetBytesCid([]byte("file"))
+	if err != nil {
+		t.Fatalf("error computing cid: %s", err)
+	}
+	_ = fb.AddFile(c, &FileMeta{ExpiredAt: now.Add(-time.Hour), Downloaded: true, Available: true,
+		Path: "/tmp/file", ChunkSize: 64})
+
+	if err = fb.AddFile(c, &FileMeta{ExpiredAt: now.Add(time.Hour), ChunkSize: 64}); err == nil {
+		t.Fatal("file which is not expired yet was replaced")
+	}
+	fb.purgeExpired(now)
+	if err = fb.AddFile(c, &FileMeta{ExpiredAt: now.Add(time.Hour), ChunkSize: 64}); err != nil {
+		t.Fatalf("expired file was not replaced: %s", err)
+	}
+	meta := fb.Snapshot(c)
+	if meta.IsExpired() || !meta.Available || meta.Path != "/tmp/file" {
+		t.Fatalf("downloaded copy of expired file was not kept: %+v", meta)
+	}
+}
@@ -1,13 +1,19 @@
 package protocols
 
 import (
+	"context"
 	"encoding/json"
+	"sync"
+	"time"
+
 	"github.com/golang/protobuf/proto"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/pkg/errors"
 
+	"happystoic/p2pnetwork/pkg/config"
+	"happystoic/p2pnetwork/pkg/files"
 	"happystoic/p2pnetwork/pkg/messaging/pb"
 	"happystoic/p2pnetwork/pkg/messaging/utils"
 )
@@ -16,26 +22,129 @@ var log = logging.Logger("iris")
 
 // p2p protocol definition
 const p2pAlertProtocol = "/alert/0.0.1"
+const p2pAlertRevokeProtocol = "/alert-revoke/0.0.1"
+const p2pAlertSyncProtocol = "/alert-sync/0.0.1"
+
+// false positive probability of bloom filter summarising known alerts
+const alertSyncFpRate = 0.01
+
+// ErrRevocationWindowExpired is returned when TL revokes its alert later than
+// the revocation window allows
+var ErrRevocationWindowExpired = errors.New("revocation window of the alert has expired")
 
 // AlertProtocol type
 type AlertProtocol struct {
 	*utils.ProtoUtils
+
+	spreader          *Spreader
+	aggregationWindow time.Duration
+
+	// history of recent authenticated alerts for peers that connect later
+	history *utils.MessageHistory
+
+	// aggregated holds alerts waiting in aggregation window by content key
+	aggregatedLock sync.Mutex
+	aggregated     map[string]*aggregatedAlert
+
+	// authors and routes of known alerts, used to process and forward
+	// alert revocations
+	routes           *alertRoutes
+	revocationWindow time.Duration
+
+	// cancel functions of alerts that are being spread
+	alertsLock sync.Mutex
+	spreading  map[string]context.CancelFunc
 }
 
 type RedisAlertRequestData struct {
-	Payload interface{} `json:"payload"`
+	// AlertId is optional. If set, it is used as ID of the alert, so TL can
+	// revoke the alert later. It should be unique (e.g. UUID)
+	AlertId string `json:"alert_id"`
+	// Severity is optional. When set, alert is spread with reliability-weighted
+	// strategy of given severity instead of flooding all peers
+	Severity string `json:"severity"`
+	// ContentKey is optional. Alerts with the same key are aggregated
+	ContentKey string      `json:"content_key"`
+	Payload    interface{} `json:"payload"`
 }
 
 type RedisAlertResponseData struct {
+	AlertId string `json:"alert_id"`
+	// Sender is the peer the alert was received from
+	Sender utils.PeerMetadata `json:"sender"`
+	// Author is the peer that created and signed the alert
+	Author utils.PeerMetadata `json:"author"`
+	// Path are peers that forwarded the alert from its author to Sender
+	// (including), each of them verified by its signature
+	Path       []utils.PeerMetadata `json:"path"`
+	Severity   string               `json:"severity,omitempty"`
+	ContentKey string               `json:"content_key,omitempty"`
+	// Senders are distinct authors of all aggregated alerts with ContentKey
+	Senders []utils.PeerMetadata `json:"senders,omitempty"`
+	Payload interface{}          `json:"payload"`
+}
+
+type RedisAlertRevokeRequestData struct {
+	AlertId string      `json:"alert_id"`
+	Payload interface{} `json:"payload"`
+}
+
+type RedisAlertRevokedData struct {
+	AlertId string             `json:"alert_id"`
 	Sender  utils.PeerMetadata `json:"sender"`
 	Payload interface{}        `json:"payload"`
 }
 
-func NewAlertProtocol(pu *utils.ProtoUtils) *AlertProtocol {
-	ap := &AlertProtocol{pu}
+// aggregatedAlert holds alerts with the same content key waiting in
+// aggregation window in order of their arrival. The first one is sent to TL
+// with authors of all of them
+type aggregatedAlert struct {
+	alerts []*RedisAlertResponseData
+}
+
+// merged returns the first alert listing distinct authors of all alerts
+func (agg *aggregatedAlert) merged() *RedisAlertResponseData {
+	resp := agg.alerts[0]
+	resp.Senders = make([]utils.PeerMetadata, 0, len(agg.alerts))
+	authors := make(map[string]struct{})
+	for _, alert := range agg.alerts {
+		if _, known := authors[alert.Author.Id]; !known {
+			authors[alert.Author.Id] = struct{}{}
+			resp.Senders = append(resp.Senders, alert.Author)
+		}
+	}
+	return resp
+}
+
+// remove removes alert with given ID and returns whether it was present
+func (agg *aggregatedAlert) remove(alertId string) bool {
+	for i, alert := range agg.alerts {
+		if alert.AlertId == alertId {
+			agg.alerts = append(agg.alerts[:i], agg.alerts[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func NewAlertProtocol(ctx context.Context, pu *utils.ProtoUtils, cfg *config.AlertSettings) *AlertProtocol {
+	spreader := NewSpreader(ctx, pu, defaultAlertStrategies, cfg.SpreadSettings)
+	ap := &AlertProtocol{
+		ProtoUtils:        pu,
+		spreader:          spreader,
+		aggregationWindow: cfg.AggregationWindow,
+		aggregated:        make(map[string]*aggregatedAlert),
+		routes:            newAlertRoutes(cfg.MaxRevocableAlerts),
+		revocationWindow:  cfg.RevocationWindow,
+		spreading:         make(map[string]context.CancelFunc),
+		history:           utils.NewMessageHistory(cfg.HistorySize, cfg.HistoryTtl, nil),
+	}
 
 	ap.Host.SetStreamHandler(p2pAlertProtocol, ap.onP2PAlertMessage)
+	ap.Host.SetStreamHandler(p2pAlertRevokeProtocol, ap.onP2PAlertRevokeMessage)
+	ap.Host.SetStreamHandler(p2pAlertSyncProtocol, ap.onP2PAlertSyncRequest)
 	_ = ap.RedisClient.SubscribeCallback("tl2nl_alert", ap.onRedisAlertMessage)
+	_ = ap.RedisClient.SubscribeCallback("tl2nl_alert_revoke", ap.onRedisAlertRevokeMessage)
 	return ap
 }
 
@@ -47,16 +156,29 @@ func (ap *AlertProtocol) onRedisAlertMessage(data []byte) {
 		return
 	}
 	log.Debug("received alert message from TL")
-	ap.InitiateP2PAlert(alertData.Payload)
+	ap.InitiateP2PAlert(&alertData)
 }
 
-// InitiateP2PAlert initiates an alert message and sends it to all connected peers
-func (ap *AlertProtocol) InitiateP2PAlert(payload interface{}) {
-	alert, err := ap.createP2PAlert(payload)
+// InitiateP2PAlert initiates an alert message. Alert without severity is sent
+// to all connected peers, otherwise it is spread based on severity strategy
+func (ap *AlertProtocol) InitiateP2PAlert(req *RedisAlertRequestData) {
+	if req.Severity != "" {
+		if _, err := files.SeverityFromString(req.Severity); err != nil {
+			log.Errorf("error initiating alert: %s", err)
+			return
+		}
+	}
+	alert, err := ap.createP2PAlert(req)
 	if err != nil {
 		log.Error(err)
 		return
 	}
+	ap.history.Add(alert.Metadata.Id, alert)
+
+	if alert.Severity != "" {
+		ap.SpreadP2PAlert(alert, ap.Host.ID())
+		return
+	}
 
 	// send alert to all connected peers
 	for _, pid := range ap.ConnectedPeers() {
@@ -64,12 +186,14 @@ func (ap *AlertProtocol) InitiateP2PAlert(payload interface{}) {
 		err = ap.SendProtoMessage(pid, p2pAlertProtocol, alert)
 		if err != nil {
 			log.Errorf("error sending alert message to node %s: %s", pid, err)
+			continue
 		}
+		ap.routes.addPeer(alert.Metadata.Id, pid)
 	}
 }
 
-func (ap *AlertProtocol) createP2PAlert(payload interface{}) (*pb.Alert, error) {
-	payloadBytes, err := json.Marshal(payload)
+func (ap *AlertProtocol) createP2PAlert(req *RedisAlertRequestData) (*pb.Alert, error) {
+	payloadBytes, err := json.Marshal(req.Payload)
 	if err != nil {
 		return nil, err
 	}
@@ -77,13 +201,22 @@ func (ap *AlertProtocol) createP2PAlert(payload interface{}) (*pb.Alert, error)
 	if err != nil {
 		return nil, errors.WithMessage(err, "error generating new proto metadata: ")
 	}
+	if req.AlertId != "" {
+		if ap.WasMsgSeen(req.AlertId) {
+			return nil, errors.Errorf("alert with id %s already exists", req.AlertId)
+		}
+		msgMetaData.Id = req.AlertId
+	}
 
 	// store this msg as seen in case it comes back from another peer
 	ap.NewMsgSeen(msgMetaData.Id, ap.Host.ID())
+	ap.routes.add(msgMetaData.Id, ap.Host.ID(), ap.Host.ID())
 
 	protoMsg := &pb.Alert{
-		Metadata: msgMetaData,
-		Payload:  payloadBytes,
+		Metadata:   msgMetaData,
+		Payload:    payloadBytes,
+		Severity:   req.Severity,
+		ContentKey: req.ContentKey,
 	}
 	signature, err := ap.SignProtoMessage(protoMsg)
 	if err != nil {
@@ -93,16 +226,28 @@ func (ap *AlertProtocol) createP2PAlert(payload interface{}) (*pb.Alert, error)
 	return protoMsg, err
 }
 
-func (ap *AlertProtocol) createRedisAlert(s network.Stream, payload []byte) (*RedisAlertResponseData, error) {
+func (ap *AlertProtocol) createRedisAlert(sender peer.ID, author peer.ID, path []peer.ID,
+	alert *pb.Alert) (*RedisAlertResponseData, error) {
+
 	var v interface{}
-	err := json.Unmarshal(payload, &v)
+	err := json.Unmarshal(alert.Payload, &v)
 	if err != nil {
 		return nil, err
 	}
 
+	pathMeta := make([]utils.PeerMetadata, 0, len(path))
+	for _, p := range path {
+		pathMeta = append(pathMeta, ap.MetadataOfPeer(p))
+	}
+
 	return &RedisAlertResponseData{
-		Sender:  ap.MetadataOfPeer(s.Conn().RemotePeer()),
-		Payload: v,
+		AlertId:    alert.Metadata.Id,
+		Sender:     ap.MetadataOfPeer(sender),
+		Author:     ap.MetadataOfPeer(author),
+		Path:       pathMeta,
+		Severity:   alert.Severity,
+		ContentKey: alert.ContentKey,
+		Payload:    v,
 	}, nil
 }
 
@@ -123,43 +268,540 @@ func (ap *AlertProtocol) onP2PAlertMessage(s network.Stream) {
 	}
 	ap.NewMsgSeen(alert.Metadata.Id, s.Conn().RemotePeer())
 
-	err = ap.AuthenticateMessage(alert, alert.Metadata)
+	err = ap.processP2PAlert(alert, s.Conn().RemotePeer())
 	if err != nil {
-		log.Errorf("error authenticating alert message: %s", err)
+		log.Error(err)
 		return
 	}
 
+	// Forward alert msg to other connected peers
+	if alert.Severity != "" {
+		ap.SpreadP2PAlert(alert, s.Conn().RemotePeer())
+	} else {
+		ap.ForwardP2PAlert(alert, s.Conn().RemotePeer())
+	}
+
+	log.Debugf("onP2PAlertMessage handler successfully ended")
+}
+
+// processP2PAlert authenticates received alert, stores it in the history and
+// sends it to local TL
+func (ap *AlertProtocol) processP2PAlert(alert *pb.Alert, sender peer.ID) error {
+	// forwarding path is not signed by the author, so remove it while
+	// authenticating the alert
+	forwardPath := alert.Path
+	alert.Path = nil
+	err := ap.AuthenticateMessage(alert, alert.Metadata)
+	alert.Path = forwardPath
+	if err != nil {
+		return errors.WithMessage(err, "error authenticating alert message: ")
+	}
+
+	path, err := ap.verifyForwardPath(alert, sender)
+	if err != nil {
+		if rErr := ap.ReportPeer(sender, "forwarded alert with invalid forwarding path"); rErr != nil {
+			log.Errorf("error reporting peer: %s", rErr)
+		}
+		return errors.WithMessage(err, "error verifying alert forwarding path: ")
+	}
+
 	log.Debugf("Received Alert message authored by %s and forwarded by %s",
-		alert.Metadata.OriginalSender.NodeId, s.Conn().RemotePeer())
+		alert.Metadata.OriginalSender.NodeId, sender)
 
-	resp, err := ap.createRedisAlert(s, alert.Payload)
+	author, err := peer.Decode(alert.Metadata.OriginalSender.NodeId)
 	if err != nil {
-		log.Errorf("error creating alert message for redis: %s", err)
-		return
+		return errors.WithMessage(err, "error decoding alert author peer ID: ")
 	}
+	ap.routes.add(alert.Metadata.Id, author, sender)
+	ap.history.Add(alert.Metadata.Id, alert)
 
-	err = ap.RedisClient.PublishMessage("nl2tl_alert", resp)
+	resp, err := ap.createRedisAlert(sender, author, path, alert)
 	if err != nil {
-		log.Errorf("Error passing alert to trust layer: %s", err)
+		return errors.WithMessage(err, "error creating alert message for redis: ")
+	}
+
+	if alert.ContentKey != "" && ap.aggregationWindow > 0 {
+		ap.aggregateAlert(resp)
+	} else {
+		err = ap.RedisClient.PublishMessage("nl2tl_alert", resp)
+		if err != nil {
+			return errors.WithMessage(err, "Error passing alert to trust layer: ")
+		}
+	}
+	return nil
+}
+
+// aggregateAlert merges alert with all alerts with the same content key
+// received during aggregation window. After the window elapses, one alert
+// listing all distinct authors is sent to TL
+func (ap *AlertProtocol) aggregateAlert(resp *RedisAlertResponseData) {
+	ap.aggregatedLock.Lock()
+	defer ap.aggregatedLock.Unlock()
+
+	if agg, exists := ap.aggregated[resp.ContentKey]; exists {
+		agg.alerts = append(agg.alerts, resp)
+		log.Debugf("aggregated alert with content key '%s', %d alerts so far",
+			resp.ContentKey, len(agg.alerts))
 		return
 	}
 
-	// Forward alert msg to other connected peers
-	ap.ForwardP2PAlert(alert, s.Conn().RemotePeer())
+	ap.aggregated[resp.ContentKey] = &aggregatedAlert{
+		alerts: []*RedisAlertResponseData{resp},
+	}
+	time.AfterFunc(ap.aggregationWindow, func() {
+		ap.aggregatedLock.Lock()
+		agg := ap.aggregated[resp.ContentKey]
+		delete(ap.aggregated, resp.ContentKey)
+		ap.aggregatedLock.Unlock()
 
-	log.Debugf("onP2PAlertMessage handler successfully ended")
+		if len(agg.alerts) == 0 {
+			// all aggregated alerts were revoked in the meantime
+			return
+		}
+		err := ap.RedisClient.PublishMessage("nl2tl_alert", agg.merged())
+		if err != nil {
+			log.Errorf("Error passing aggregated alert to trust layer: %s", err)
+		}
+	})
 }
 
-func (ap *AlertProtocol) ForwardP2PAlert(protoMsg proto.Message, senderID peer.ID) {
+// dropAggregatedAlert removes revoked alert waiting in aggregation window, so
+// it is not sent to TL. It returns true if the alert was waiting there
+func (ap *AlertProtocol) dropAggregatedAlert(alertId string) bool {
+	ap.aggregatedLock.Lock()
+	defer ap.aggregatedLock.Unlock()
+
+	for _, agg := range ap.aggregated {
+		if agg.remove(alertId) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ap *AlertProtocol) ForwardP2PAlert(alert *pb.Alert, senderID peer.ID) {
+	forwarded, err := ap.withForwardHop(alert)
+	if err != nil {
+		log.Errorf("error adding forward hop to alert: %s", err)
+		return
+	}
+
 	for _, pid := range ap.ConnectedPeers() {
 		if pid == senderID {
 			continue // do not send it back
 		}
 
 		log.Debugf("Forwarding alert message to peer %s", pid)
-		err := ap.SendProtoMessage(pid, p2pAlertProtocol, protoMsg)
+		err := ap.SendProtoMessage(pid, p2pAlertProtocol, forwarded)
 		if err != nil {
 			log.Errorf("error forwarding alert message to node %s: %s", pid, err)
+			continue
 		}
+		ap.routes.addPeer(alert.Metadata.Id, pid)
+	}
+}
+
+// forwardHopData returns data which is signed by i-th forwarder of the alert.
+// It binds the forwarder to the alert and to all the previous hops
+func forwardHopData(alert *pb.Alert, i int, forwarderId string) []byte {
+	previous := alert.Metadata.Signature
+	if i > 0 {
+		previous = alert.Path[i-1].Signature
+	}
+	data := make([]byte, 0, len(alert.Metadata.Id)+len(previous)+len(forwarderId))
+	data = append(data, alert.Metadata.Id...)
+	data = append(data, previous...)
+	return append(data, forwarderId...)
+}
+
+// withForwardHop returns copy of the alert with this peer appended to its
+// forwarding path. Alerts authored by this peer are returned unchanged
+func (ap *AlertProtocol) withForwardHop(alert *pb.Alert) (*pb.Alert, error) {
+	if alert.Metadata.OriginalSender.NodeId == ap.Host.ID().String() {
+		return alert, nil
+	}
+	identity, err := ap.MyIdentity()
+	if err != nil {
+		return nil, err
+	}
+	forwarded := proto.Clone(alert).(*pb.Alert)
+	signature, err := ap.SignData(forwardHopData(forwarded, len(forwarded.Path), identity.NodeId))
+	if err != nil {
+		return nil, err
+	}
+	forwarded.Path = append(forwarded.Path, &pb.ForwardHop{
+		Forwarder: identity,
+		Signature: signature,
+	})
+	return forwarded, nil
+}
+
+// verifyForwardPath verifies signatures of all forwarders of the alert and
+// checks that the last one is the peer we received the alert from. It returns
+// forwarders from the closest to the author
+func (ap *AlertProtocol) verifyForwardPath(alert *pb.Alert, sender peer.ID) ([]peer.ID, error) {
+	path := make([]peer.ID, 0, len(alert.Path))
+	for i, hop := range alert.Path {
+		if hop.Forwarder == nil {
+			return nil, errors.Errorf("hop %d has no forwarder", i)
+		}
+		err := ap.VerifyData(hop.Forwarder, forwardHopData(alert, i, hop.Forwarder.NodeId), hop.Signature)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "invalid signature of hop %d: ", i)
+		}
+		forwarder, err := peer.Decode(hop.Forwarder.NodeId)
+		if err != nil {
+			return nil, err
+		}
+		path = append(path, forwarder)
+	}
+
+	lastHop := alert.Metadata.OriginalSender.NodeId
+	if len(path) != 0 {
+		lastHop = path[len(path)-1].String()
+	}
+	if lastHop != sender.String() {
+		return nil, errors.Errorf("alert was sent by %s but the last hop is %s", sender, lastHop)
+	}
+	return path, nil
+}
+
+// SpreadP2PAlert spreads alert with severity to peers selected by their
+// reliability. Number of peers and repetition is given by severity strategy
+func (ap *AlertProtocol) SpreadP2PAlert(alert *pb.Alert, senderID peer.ID) {
+	sev, err := files.SeverityFromString(alert.Severity)
+	if err != nil {
+		log.Errorf("error spreading alert message: %s", err)
+		return
+	}
+	forwarded, err := ap.withForwardHop(alert)
+	if err != nil {
+		log.Errorf("error adding forward hop to alert: %s", err)
+		return
+	}
+	alertId := alert.Metadata.Id
+	// lock is held until the cancel function is stored, so the entry is not
+	// deleted by spreading which ends sooner
+	ap.alertsLock.Lock()
+	defer ap.alertsLock.Unlock()
+	onSent := func(p peer.ID) {
+		ap.routes.addPeer(alertId, p)
+	}
+	ap.spreading[alertId] = ap.spreader.startSpreading(p2pAlertProtocol, sev, nil, forwarded, senderID, onSent, func() {
+		ap.alertsLock.Lock()
+		defer ap.alertsLock.Unlock()
+		delete(ap.spreading, alertId)
+	})
+}
+
+func (ap *AlertProtocol) authorOfAlert(alertId string) (peer.ID, bool) {
+	author, _, _, ok := ap.routes.get(alertId)
+	return author, ok
+}
+
+// stopSpreading stops periodical spreading of alert with given ID if running
+func (ap *AlertProtocol) stopSpreading(alertId string) {
+	ap.alertsLock.Lock()
+	defer ap.alertsLock.Unlock()
+	if cancel, exists := ap.spreading[alertId]; exists {
+		cancel()
+		delete(ap.spreading, alertId)
+	}
+}
+
+func (ap *AlertProtocol) onRedisAlertRevokeMessage(data []byte) {
+	revokeData := RedisAlertRevokeRequestData{}
+	err := json.Unmarshal(data, &revokeData)
+	if err != nil {
+		log.Errorf("error unmarshalling RedisAlertRevokeRequestData from redis: %s", err)
+		return
+	}
+	log.Debug("received alert revoke message from TL")
+
+	err = ap.RevokeAlert(&revokeData)
+	if err != nil {
+		log.Errorf("error revoking alert %s: %s", revokeData.AlertId, err)
+	}
+}
+
+// RevokeAlert sends revocation of alert authored by this peer along the route
+// the alert was sent. Alert can be revoked only during revocation window after
+// it was sent, ErrRevocationWindowExpired is returned later
+func (ap *AlertProtocol) RevokeAlert(req *RedisAlertRevokeRequestData) error {
+	author, added, peers, exists := ap.routes.get(req.AlertId)
+	if !exists || author != ap.Host.ID() {
+		return errors.Errorf("alert %s is not known to be authored by this peer", req.AlertId)
+	}
+	if time.Since(added) > ap.revocationWindow {
+		return ErrRevocationWindowExpired
+	}
+
+	revoke, err := ap.createP2PAlertRevoke(req)
+	if err != nil {
+		return errors.WithMessage(err, "error creating p2p alert revoke: ")
+	}
+	ap.stopSpreading(revoke.AlertId)
+	ap.history.Remove(revoke.AlertId)
+	ap.ForwardP2PAlertRevoke(revoke, peers, ap.Host.ID())
+	return nil
+}
+
+func (ap *AlertProtocol) createP2PAlertRevoke(req *RedisAlertRevokeRequestData) (*pb.AlertRevoke, error) {
+	payloadBytes, err := json.Marshal(req.Payload)
+	if err != nil {
+		return nil, err
+	}
+	msgMetaData, err := ap.NewProtoMetaData()
+	if err != nil {
+		return nil, errors.WithMessage(err, "error generating new proto metadata: ")
+	}
+
+	// store this msg as seen in case it comes back from another peer
+	ap.NewMsgSeen(msgMetaData.Id, ap.Host.ID())
+
+	protoMsg := &pb.AlertRevoke{
+		Metadata: msgMetaData,
+		AlertId:  req.AlertId,
+		Payload:  payloadBytes,
+	}
+	signature, err := ap.SignProtoMessage(protoMsg)
+	if err != nil {
+		return nil, errors.WithMessage(err, "error generating signature for new alert revoke message: ")
+	}
+	protoMsg.Metadata.Signature = signature
+	return protoMsg, nil
+}
+
+// onP2PAlertRevokeMessage receives an alert revocation. If it was authored by
+// the author of the revoked alert, it is sent to local TL and forwarded further
+// along the route of the alert. Peers that do not know the revoked alert drop it
+func (ap *AlertProtocol) onP2PAlertRevokeMessage(s network.Stream) {
+	log.Infof("received p2p alert revoke message")
+	revoke := &pb.AlertRevoke{}
+
+	err := ap.DeserializeMessageFromStream(s, revoke, true)
+	if err != nil {
+		log.Errorf("error deserilising alert revoke proto message from stream: %s", err)
+		return
+	}
+
+	if ap.WasMsgSeen(revoke.Metadata.Id) {
+		log.Debugf("received already seen alert revoke message, forwarded by %s", s.Conn().RemotePeer())
+		return
+	}
+	ap.NewMsgSeen(revoke.Metadata.Id, s.Conn().RemotePeer())
+
+	err = ap.AuthenticateMessage(revoke, revoke.Metadata)
+	if err != nil {
+		log.Errorf("error authenticating alert revoke message: %s", err)
+		return
+	}
+
+	revokeAuthor, err := peer.Decode(revoke.Metadata.OriginalSender.NodeId)
+	if err != nil {
+		log.Errorf("error decoding alert revoke author peer ID: %s", err)
+		return
+	}
+	alertAuthor, _, route, exists := ap.routes.get(revoke.AlertId)
+	if !exists {
+		log.Debugf("received revoke of unknown alert %s, dropping it", revoke.AlertId)
+		return
+	}
+	if alertAuthor != revokeAuthor {
+		log.Errorf("peer %s tried to revoke alert %s authored by %s", revokeAuthor, revoke.AlertId, alertAuthor)
+		err = ap.ReportPeer(revokeAuthor, "tried to revoke alert of another peer")
+		if err != nil {
+			log.Errorf("error reporting peer: %s", err)
+		}
+		return
+	}
+	ap.stopSpreading(revoke.AlertId)
+	ap.history.Remove(revoke.AlertId)
+	if ap.dropAggregatedAlert(revoke.AlertId) {
+		// TL has not received the alert yet, so it does not need the revoke
+		log.Debugf("revoked alert %s was waiting in aggregation window, dropped it", revoke.AlertId)
+		ap.ForwardP2PAlertRevoke(revoke, route, s.Conn().RemotePeer())
+		return
+	}
+
+	var v interface{}
+	err = json.Unmarshal(revoke.Payload, &v)
+	if err != nil {
+		log.Errorf("error unmarshalling alert revoke payload: %s", err)
+		return
+	}
+	resp := &RedisAlertRevokedData{
+		AlertId: revoke.AlertId,
+		Sender:  ap.MetadataOfPeer(alertAuthor),
+		Payload: v,
+	}
+	err = ap.RedisClient.PublishMessage("nl2tl_alert_revoked", resp)
+	if err != nil {
+		log.Errorf("Error passing alert revoke to trust layer: %s", err)
+		return
+	}
+
+	ap.ForwardP2PAlertRevoke(revoke, route, s.Conn().RemotePeer())
+	log.Debugf("onP2PAlertRevokeMessage handler successfully ended")
+}
+
+// ForwardP2PAlertRevoke sends revocation to peers on the route of the revoked
+// alert, i.e. to peers the alert was received from or sent to
+func (ap *AlertProtocol) ForwardP2PAlertRevoke(revoke *pb.AlertRevoke, route []peer.ID, senderID peer.ID) {
+	for _, pid := range route {
+		if pid == senderID {
+			continue // do not send it back
+		}
+
+		log.Debugf("Forwarding alert revoke message to peer %s", pid)
+		err := ap.SendProtoMessage(pid, p2pAlertRevokeProtocol, revoke)
+		if err != nil {
+			log.Errorf("error forwarding alert revoke message to node %s: %s", pid, err)
+		}
+	}
+}
+
+// RequestMissingAlerts sends peer p a summary of recent alerts this peer
+// knows. The peer responds with its recent alerts missing in the summary which
+// are then sent to local TL
+func (ap *AlertProtocol) RequestMissingAlerts(p peer.ID) {
+	log.Debugf("requesting missing alerts from peer '%s'", p)
+
+	req, err := ap.createP2PAlertSyncRequest()
+	if err != nil {
+		log.Errorf("error creating alert sync request: %s", err)
+		return
+	}
+
+	s, err := ap.InitiateStream(p, p2pAlertSyncProtocol, req)
+	if err != nil {
+		log.Errorf("error sending alert sync request to %s: %s", p, err)
+		return
+	}
+	_ = s.CloseWrite()
+	defer s.Close()
+
+	resp := &pb.AlertSyncResponse{}
+	err = ap.DeserializeMessageFromStream(s, resp, false)
+	if err != nil {
+		log.Errorf("error deserilising alert sync response from stream: %s", err)
+		return
+	}
+	err = ap.AuthenticateMessage(resp, resp.Metadata)
+	if err != nil {
+		log.Errorf("error authenticating alert sync response: %s", err)
+		return
+	}
+
+	received := 0
+	for _, alert := range resp.Alerts {
+		if alert.Metadata == nil || ap.WasMsgSeen(alert.Metadata.Id) {
+			continue
+		}
+		ap.NewMsgSeen(alert.Metadata.Id, p)
+
+		err = ap.processP2PAlert(alert, p)
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		received++
+	}
+	log.Debugf("received %d missing alerts from peer '%s'", received, p)
+}
+
+func (ap *AlertProtocol) createP2PAlertSyncRequest() (*pb.AlertSyncRequest, error) {
+	ids := ap.history.IDs()
+	filter := utils.NewBloomFilter(len(ids), alertSyncFpRate)
+	for _, id := range ids {
+		filter.Add(id)
+	}
+
+	msgMetaData, err := ap.NewProtoMetaData()
+	if err != nil {
+		return nil, errors.WithMessage(err, "error generating new proto metadata: ")
+	}
+	protoMsg := &pb.AlertSyncRequest{
+		Metadata:    msgMetaData,
+		BloomFilter: filter.Bytes(),
+		Hashes:      filter.Hashes(),
+	}
+	signature, err := ap.SignProtoMessage(protoMsg)
+	if err != nil {
+		return nil, errors.WithMessage(err, "error generating signature for new alert sync request: ")
+	}
+	protoMsg.Metadata.Signature = signature
+	return protoMsg, nil
+}
+
+// onP2PAlertSyncRequest responds with recent alerts missing in requester's
+// summary
+func (ap *AlertProtocol) onP2PAlertSyncRequest(s network.Stream) {
+	defer s.Close()
+	remote := s.Conn().RemotePeer()
+	log.Debugf("received alert sync request from '%s'", remote)
+
+	req := &pb.AlertSyncRequest{}
+	err := ap.DeserializeMessageFromStream(s, req, false)
+	if err != nil {
+		log.Errorf("error deserilising alert sync request from stream: %s", err)
+		return
+	}
+	err = ap.AuthenticateMessage(req, req.Metadata)
+	if err != nil {
+		log.Errorf("error authenticating alert sync request: %s", err)
+		return
+	}
+	filter, err := utils.BloomFilterFromBytes(req.BloomFilter, req.Hashes)
+	if err != nil {
+		log.Errorf("error decoding alert sync bloom filter: %s", err)
+		return
+	}
+
+	missing := make([]*pb.Alert, 0)
+	for _, id := range ap.history.IDs() {
+		if filter.Test(id) {
+			continue
+		}
+		msg, exists := ap.history.Get(id)
+		if !exists {
+			continue
+		}
+		if author, _ := ap.authorOfAlert(id); author == remote {
+			// do not send peer its own alerts
+			continue
+		}
+		alert, err := ap.withForwardHop(msg.(*pb.Alert))
+		if err != nil {
+			log.Errorf("error adding forward hop to alert: %s", err)
+			continue
+		}
+		missing = append(missing, alert)
+	}
+
+	msgMetaData, err := ap.NewProtoMetaData()
+	if err != nil {
+		log.Errorf("error generating new proto metadata: %s", err)
+		return
+	}
+	resp := &pb.AlertSyncResponse{
+		Metadata: msgMetaData,
+		Alerts:   missing,
+	}
+	signature, err := ap.SignProtoMessage(resp)
+	if err != nil {
+		log.Errorf("error generating signature for alert sync response: %s", err)
+		return
+	}
+	resp.Metadata.Signature = signature
+
+	err = ap.WriteProtoMsg(resp, s)
+	if err != nil {
+		log.Errorf("error sending alert sync response to peer %s: %s", remote, err)
+		return
+	}
+	for _, alert := range missing {
+		ap.routes.addPeer(alert.Metadata.Id, remote)
 	}
+	log.Debugf("sent %d missing alerts to peer '%s'", len(missing), remote)
 }
@@ -0,0 +1,88 @@
+package protocols
+
+import (
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// alertRoute records author of the alert and peers the alert was received
+// from or sent to, so its revocation can follow the same route
+type alertRoute struct {
+	author peer.ID
+	added  time.Time
+	peers  map[peer.ID]struct{}
+}
+
+// alertRoutes keeps routes of at most maxSize recent alerts independently of
+// the alert history. When it is full, the oldest routes are dropped
+type alertRoutes struct {
+	lock    sync.Mutex
+	maxSize int
+	order   []string
+	routes  map[string]*alertRoute
+}
+
+func newAlertRoutes(maxSize int) *alertRoutes {
+	return &alertRoutes{
+		maxSize: maxSize,
+		order:   make([]string, 0),
+		routes:  make(map[string]*alertRoute),
+	}
+}
+
+// add records new alert of author received from peer from. Nothing happens
+// if the alert is already known
+func (r *alertRoutes) add(alertId string, author peer.ID, from peer.ID) {
+	if r.maxSize <= 0 {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, exists := r.routes[alertId]; exists {
+		return
+	}
+	route := &alertRoute{
+		author: author,
+		added:  time.Now(),
+		peers:  make(map[peer.ID]struct{}),
+	}
+	if from != author {
+		route.peers[from] = struct{}{}
+	}
+	r.routes[alertId] = route
+	r.order = append(r.order, alertId)
+	for len(r.order) > r.maxSize {
+		delete(r.routes, r.order[0])
+		r.order = r.order[1:]
+	}
+}
+
+// addPeer records that the alert was sent to peer p
+func (r *alertRoutes) addPeer(alertId string, p peer.ID) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if route, exists := r.routes[alertId]; exists {
+		route.peers[p] = struct{}{}
+	}
+}
+
+// get returns author of the alert, time when the alert was recorded and peers
+// on its route
+func (r *alertRoutes) get(alertId string) (peer.ID, time.Time, []peer.ID, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	route, exists := r.routes[alertId]
+	if !exists {
+		return "", time.Time{}, nil, false
+	}
+	peers := make([]peer.ID, 0, len(route.peers))
+	for p := range route.peers {
+		peers = append(peers, p)
+	}
+	return route.author, route.added, peers, true
+}
@@ -0,0 +1,58 @@
+package protocols
+
+import (
+	"testing"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+func TestAlertRoutes(t *testing.T) {
+	author, forwarder, receiver := peer.ID("author"), peer.ID("forwarder"), peer.ID("receiver")
+	routes := newAlertRoutes(2)
+
+	routes.add("own", author, author)
+	routes.add("received", author, forwarder)
+	routes.addPeer("received", receiver)
+	// already known alert keeps its route
+	routes.add("received", forwarder, receiver)
+
+	tests := []struct {
+		name   string
+		author peer.ID
+		route  []peer.ID
+	}{
+		{name: "own", author: author, route: []peer.ID{}},
+		{name: "received", author: author, route: []peer.ID{forwarder, receiver}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _, route, ok := routes.get(tt.name)
+			if !ok {
+				t.Fatal("route of the alert is not known")
+			}
+			if a != tt.author {
+				t.Fatalf("author is %s, expected %s", a, tt.author)
+			}
+			if len(route) != len(tt.route) {
+				t.Fatalf("route is %v, expected %v", route, tt.route)
+			}
+			for _, p := range tt.route {
+				found := false
+				for _, r := range route {
+					found = found || r == p
+				}
+				if !found {
+					t.Fatalf("route %v does not contain %s", route, p)
+				}
+			}
+		})
+	}
+
+	routes.add("newest", author, forwarder)
+	if _, _, _, ok := routes.get("own"); ok {
+		t.Fatal("the oldest route was not dropped when routes are full")
+	}
+	if _, _, _, ok := routes.get("newest"); !ok {
+		t.Fatal("the newest route was not stored")
+	}
+}
@@ -0,0 +1,271 @@
+package protocols
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/pkg/errors"
+
+	"happystoic/p2pnetwork/pkg/files"
+)
+
+// states of download jobs
+const (
+	DownloadRunning   = "running"
+	DownloadDone      = "done"
+	DownloadFailed    = "failed"
+	DownloadCancelled = "cancelled"
+)
+
+// finished download jobs are kept for TL queries only for finishedJobsRetention
+// and at most maxFinishedJobs of them are kept
+const (
+	finishedJobsRetention = time.Hour
+	maxFinishedJobs       = 100
+)
+
+// DownloadJobState is snapshot of a download job of one file
+type DownloadJobState struct {
+	FileId           string    `json:"file_id"`
+	State            string    `json:"state"`
+	DownloadedChunks int       `json:"downloaded_chunks"`
+	TotalChunks      int       `json:"total_chunks"`
+	Requests         int       `json:"requests"` // number of TL requests coalesced into the job
+	StartedAt        time.Time `json:"started_at"`
+	FinishedAt       time.Time `json:"finished_at"`
+	Error            string    `json:"error"`
+}
+
+type Tl2NlRedisFileShareDownloadCancel struct {
+	FileId string `json:"file_id"`
+}
+
+type Nl2TlRedisFileShareDownloadJobs struct {
+	Jobs []DownloadJobState `json:"jobs"`
+}
+
+// downloadJob is a download of one file. All TL requests for the same file
+// are served by one job, so the file is not downloaded more times at once
+type downloadJob struct {
+	lock  sync.Mutex
+	state DownloadJobState
+
+	fileCid cid.Cid
+	ctx     context.Context
+	cancel  context.CancelFunc
+	// basePath is local version of the file used for delta transfer
+	basePath string
+}
+
+func (j *downloadJob) snapshot() DownloadJobState {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.state
+}
+
+func (j *downloadJob) cancelled() bool {
+	return j.ctx.Err() != nil
+}
+
+func (j *downloadJob) setProgress(downloaded, total int) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.state.DownloadedChunks, j.state.TotalChunks = downloaded, total
+}
+
+func (j *downloadJob) chunkDownloaded() {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.state.DownloadedChunks++
+}
+
+func (j *downloadJob) finish(err error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	j.state.FinishedAt = time.Now()
+	switch {
+	case j.cancelled():
+		j.state.State = DownloadCancelled
+	case err != nil:
+		j.state.State = DownloadFailed
+		j.state.Error = err.Error()
+	default:
+		j.state.State = DownloadDone
+	}
+	// release resources of the context
+	j.cancel()
+}
+
+// resetOnCancel resets the stream when the job is cancelled, so blocked reads
+// return immediately. Returned function must be called when the stream is done
+func (j *downloadJob) resetOnCancel(s network.Stream) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-j.ctx.Done():
+			_ = s.Reset()
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
+
+// startDownloadJob starts new download job of the file. If the file is
+// already being downloaded, the request is coalesced into the running job
+// and false is returned
+func (fs *FileShareProtocol) startDownloadJob(fileCid cid.Cid) (*downloadJob, bool) {
+	fs.jobsLock.Lock()
+	defer fs.jobsLock.Unlock()
+
+	if job, exists := fs.jobs[fileCid]; exists {
+		job.lock.Lock()
+		defer job.lock.Unlock()
+		if job.state.State == DownloadRunning {
+			job.state.Requests++
+			return job, false
+		}
+	}
+
+	fs.pruneDownloadJobs(time.Now())
+	ctx, cancel := context.WithCancel(fs.ctx)
+	job := &downloadJob{
+		state: DownloadJobState{
+			FileId:    fileCid.String(),
+			State:     DownloadRunning,
+			Requests:  1,
+			StartedAt: time.Now(),
+		},
+		fileCid: fileCid,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	fs.jobs[fileCid] = job
+	return job, true
+}
+
+func (fs *FileShareProtocol) cancelDownloadJob(fileCid cid.Cid) error {
+	fs.jobsLock.Lock()
+	job, exists := fs.jobs[fileCid]
+	fs.jobsLock.Unlock()
+
+	if !exists || job.snapshot().State != DownloadRunning {
+		return errors.Errorf("there is no running download of %s", fileCid.String())
+	}
+	job.cancel()
+	return nil
+}
+
+// forgetDownloadJob removes finished job of the file, it is not cancelled
+// when it is still running
+func (fs *FileShareProtocol) forgetDownloadJob(fileCid cid.Cid) {
+	fs.jobsLock.Lock()
+	defer fs.jobsLock.Unlock()
+
+	if job, exists := fs.jobs[fileCid]; exists && job.snapshot().State != DownloadRunning {
+		delete(fs.jobs, fileCid)
+	}
+}
+
+// pruneDownloadJobs removes finished jobs older than finishedJobsRetention and
+// the oldest finished jobs over maxFinishedJobs. jobsLock must be held
+func (fs *FileShareProtocol) pruneDownloadJobs(now time.Time) {
+	finished := make([]cid.Cid, 0)
+	finishedAt := make(map[cid.Cid]time.Time)
+	for c, job := range fs.jobs {
+		state := job.snapshot()
+		if state.State == DownloadRunning {
+			continue
+		}
+		if now.Sub(state.FinishedAt) > finishedJobsRetention {
+			delete(fs.jobs, c)
+			continue
+		}
+		finished = append(finished, c)
+		finishedAt[c] = state.FinishedAt
+	}
+	if len(finished) <= maxFinishedJobs {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		return finishedAt[finished[i]].Before(finishedAt[finished[j]])
+	})
+	for _, c := range finished[:len(finished)-maxFinishedJobs] {
+		delete(fs.jobs, c)
+	}
+}
+
+// DownloadJobs returns state of running and finished download jobs
+func (fs *FileShareProtocol) DownloadJobs() []DownloadJobState {
+	fs.jobsLock.Lock()
+	defer fs.jobsLock.Unlock()
+
+	fs.pruneDownloadJobs(time.Now())
+	states := make([]DownloadJobState, 0, len(fs.jobs))
+	for _, job := range fs.jobs {
+		states = append(states, job.snapshot())
+	}
+	return states
+}
+
+func (fs *FileShareProtocol) onDownloadCancel(data []byte) {
+	cancelReq := Tl2NlRedisFileShareDownloadCancel{}
+	err := json.Unmarshal(data, &cancelReq)
+	if err != nil {
+		log.Errorf("error unmarshalling Tl2NlRedisFileShareDownloadCancel from redis: %s", err)
+		return
+	}
+	fileCid, err := cid.Decode(cancelReq.FileId)
+	if err != nil {
+		log.Errorf("error decoding file cid: %s", err)
+		return
+	}
+	err = fs.cancelDownloadJob(fileCid)
+	if err != nil {
+		log.Errorf("error cancelling download: %s", err)
+		return
+	}
+	log.Infof("cancelled download of %s", fileCid.String())
+}
+
+// onDownloadJobsQuery sends state of all download jobs to TL
+func (fs *FileShareProtocol) onDownloadJobsQuery(_ []byte) {
+	msg := Nl2TlRedisFileShareDownloadJobs{Jobs: fs.DownloadJobs()}
+	err := fs.RedisClient.PublishMessage("nl2tl_file_share_download_jobs", msg)
+	if err != nil {
+		log.Errorf("error sending download jobs to redis: %s", err)
+	}
+}
+
+func (fs *FileShareProtocol) notifyTLAboutProgress(job *downloadJob) {
+	fs.publishProgress(job.snapshot())
+}
+
+// notifyTLAboutAvailableFile tells TL that requested file is already
+// available, so no download is needed
+func (fs *FileShareProtocol) notifyTLAboutAvailableFile(fileCid cid.Cid, meta *files.FileMeta) {
+	now := time.Now()
+	fs.publishProgress(DownloadJobState{
+		FileId:           fileCid.String(),
+		State:            DownloadDone,
+		DownloadedChunks: len(meta.ChunkHashes),
+		TotalChunks:      len(meta.ChunkHashes),
+		Requests:         1,
+		StartedAt:        now,
+		FinishedAt:       now,
+	})
+}
+
+func (fs *FileShareProtocol) publishProgress(state DownloadJobState) {
+	err := fs.RedisClient.PublishMessage("nl2tl_file_share_download_progress", state)
+	if err != nil {
+		log.Errorf("error sending download progress to redis: %s", err)
+	}
+}
@@ -0,0 +1,44 @@
+package protocols
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+)
+
+func TestPruneDownloadJobs(t *testing.T) {
+	now := time.Now()
+	fs := &FileShareProtocol{jobs: make(map[cid.Cid]*downloadJob)}
+	addJob := func(name, state string, finishedAt time.Time) cid.Cid {
+		c := testFileCid(t, name)
+		fs.jobs[c] = &downloadJob{
+			state:   DownloadJobState{FileId: c.String(), State: state, FinishedAt: finishedAt},
+			fileCid: c,
+		}
+		return c
+	}
+
+	running := addJob("running", DownloadRunning, time.Time{})
+	old := addJob("old", DownloadDone, now.Add(-finishedJobsRetention-time.Second))
+	recent := make([]cid.Cid, 0, maxFinishedJobs+1)
+	for i := 0; i <= maxFinishedJobs; i++ {
+		recent = append(recent, addJob(fmt.Sprintf("recent %d", i), DownloadFailed,
+			now.Add(-time.Duration(maxFinishedJobs-i)*time.Second)))
+	}
+
+	fs.pruneDownloadJobs(now)
+	if _, ok := fs.jobs[running]; !ok {
+		t.Fatal("running job was pruned")
+	}
+	if _, ok := fs.jobs[old]; ok {
+		t.Fatal("job finished before retention period was kept")
+	}
+	if _, ok := fs.jobs[recent[0]]; ok {
+		t.Fatal("the oldest finished job over the limit was kept")
+	}
+	if len(fs.jobs) != maxFinishedJobs+1 {
+		t.Fatalf("%d jobs kept, expected %d finished and one running", len(fs.jobs), maxFinishedJobs)
+	}
+}
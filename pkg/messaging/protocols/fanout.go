@@ -0,0 +1,69 @@
+package protocols
+
+import (
+	"math"
+	"sync"
+
+	"happystoic/p2pnetwork/pkg/config"
+)
+
+// weight of a new response in the moving average of unprocessed responses
+const unprocessedRatioWeight = 0.2
+
+// FanoutController computes to how many peers a request should be sent.
+// Fanout shrinks with depth of the request in the network. In adaptive mode,
+// fanout is raised when too many peers respond they did not process the
+// request (they had already seen it) and lowered back when they process it
+type FanoutController struct {
+	settings *config.IntelligenceSettings
+
+	lock             sync.Mutex
+	extra            int
+	unprocessedRatio float64
+}
+
+func NewFanoutController(settings *config.IntelligenceSettings) *FanoutController {
+	return &FanoutController{settings: settings}
+}
+
+// Fanout returns number of peers to send request to at given depth
+func (fc *FanoutController) Fanout(depth uint32) int {
+	fc.lock.Lock()
+	base := fc.settings.Fanout + fc.extra
+	fc.lock.Unlock()
+
+	fanout := int(math.Floor(float64(base) * math.Pow(fc.settings.FanoutDecay, float64(depth))))
+	if fanout < fc.settings.MinFanout {
+		fanout = fc.settings.MinFanout
+	}
+	return fanout
+}
+
+// RecordResponse updates adaptive fanout with information whether a peer
+// processed the request or not
+func (fc *FanoutController) RecordResponse(processed bool) {
+	if !fc.settings.AdaptiveFanout {
+		return
+	}
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+
+	sample := 0.0
+	if !processed {
+		sample = 1
+	}
+	fc.unprocessedRatio = (1-unprocessedRatioWeight)*fc.unprocessedRatio + unprocessedRatioWeight*sample
+
+	threshold := fc.settings.UnprocessedThreshold
+	switch {
+	case fc.unprocessedRatio > threshold && fc.settings.Fanout+fc.extra < fc.settings.MaxFanout:
+		fc.extra++
+	case fc.unprocessedRatio < threshold/4 && fc.extra > 0:
+		fc.extra--
+	default:
+		return
+	}
+	// start measuring anew after each change
+	fc.unprocessedRatio = threshold / 2
+	log.Debugf("adaptive fanout of intelligence requests changed to %d", fc.settings.Fanout+fc.extra)
+}
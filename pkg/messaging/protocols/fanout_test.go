@@ -0,0 +1,117 @@
+package protocols
+
+import (
+	"testing"
+
+	"happystoic/p2pnetwork/pkg/config"
+)
+
+func TestFanoutDecay(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings config.IntelligenceSettings
+		depth    uint32
+		expected int
+	}{
+		{
+			name:     "no decay",
+			settings: config.IntelligenceSettings{Fanout: 3, FanoutDecay: 1, MinFanout: 1},
+			depth:    4,
+			expected: 3,
+		},
+		{
+			name:     "initiator uses whole fanout",
+			settings: config.IntelligenceSettings{Fanout: 8, FanoutDecay: 0.5, MinFanout: 1},
+			depth:    0,
+			expected: 8,
+		},
+		{
+			name:     "fanout decays with depth",
+			settings: config.IntelligenceSettings{Fanout: 8, FanoutDecay: 0.5, MinFanout: 1},
+			depth:    2,
+			expected: 2,
+		},
+		{
+			name:     "decayed fanout is rounded down",
+			settings: config.IntelligenceSettings{Fanout: 5, FanoutDecay: 0.5, MinFanout: 1},
+			depth:    1,
+			expected: 2,
+		},
+		{
+			name:     "fanout does not fall below min fanout",
+			settings: config.IntelligenceSettings{Fanout: 8, FanoutDecay: 0.5, MinFanout: 2},
+			depth:    10,
+			expected: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fc := NewFanoutController(&tt.settings)
+			if fanout := fc.Fanout(tt.depth); fanout != tt.expected {
+				t.Fatalf("got fanout %d, expected %d", fanout, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAdaptiveFanout(t *testing.T) {
+	settings := config.IntelligenceSettings{Fanout: 3, FanoutDecay: 1, MinFanout: 1, MaxFanout: 5,
+		UnprocessedThreshold: 0.5}
+	record := func(fc *FanoutController, processed bool, n int) {
+		for i := 0; i < n; i++ {
+			fc.RecordResponse(processed)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		adaptive  bool
+		responses func(fc *FanoutController)
+		expected  int
+	}{
+		{
+			name:      "disabled adaptive fanout ignores responses",
+			adaptive:  false,
+			responses: func(fc *FanoutController) { record(fc, false, 100) },
+			expected:  3,
+		},
+		{
+			name:      "processed responses keep fanout",
+			adaptive:  true,
+			responses: func(fc *FanoutController) { record(fc, true, 100) },
+			expected:  3,
+		},
+		{
+			name:      "unprocessed responses raise fanout",
+			adaptive:  true,
+			responses: func(fc *FanoutController) { record(fc, false, 4) },
+			expected:  4,
+		},
+		{
+			name:      "fanout is not raised above max fanout",
+			adaptive:  true,
+			responses: func(fc *FanoutController) { record(fc, false, 100) },
+			expected:  5,
+		},
+		{
+			name:     "processed responses lower fanout back",
+			adaptive: true,
+			responses: func(fc *FanoutController) {
+				record(fc, false, 100)
+				record(fc, true, 100)
+			},
+			expected: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := settings
+			s.AdaptiveFanout = tt.adaptive
+			fc := NewFanoutController(&s)
+			tt.responses(fc)
+			if fanout := fc.Fanout(0); fanout != tt.expected {
+				t.Fatalf("got fanout %d, expected %d", fanout, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,488 @@
+package protocols
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/pkg/errors"
+
+	"happystoic/p2pnetwork/pkg/files"
+	"happystoic/p2pnetwork/pkg/messaging/pb"
+)
+
+// chunkDownload holds state of a download of one file from more providers in
+// parallel. Chunks are written into partial file as they come, so the progress
+// survives disconnect of a provider or restart of the node
+type chunkDownload struct {
+	lock sync.Mutex
+
+	job     *downloadJob
+	fileCid cid.Cid
+	meta    *files.FileMeta
+	hashes  [][]byte
+	file    *os.File
+
+	missing []uint32
+	fetched map[peer.ID]int
+}
+
+// take removes at most n missing chunks from the queue and returns them
+func (d *chunkDownload) take(n int) []uint32 {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if n > len(d.missing) {
+		n = len(d.missing)
+	}
+	batch := d.missing[:n:n]
+	d.missing = d.missing[n:]
+	return batch
+}
+
+// giveBack returns chunks which were not fetched back to the queue, so other
+// providers can download them
+func (d *chunkDownload) giveBack(chunks []uint32) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.missing = append(d.missing, chunks...)
+}
+
+func (d *chunkDownload) remaining() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return len(d.missing)
+}
+
+func (d *chunkDownload) writeChunk(index uint32, data []byte, p peer.ID) error {
+	_, err := d.file.WriteAt(data, int64(index)*d.meta.ChunkSize)
+	if err != nil {
+		return err
+	}
+	d.job.chunkDownloaded()
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.fetched[p]++
+	return nil
+}
+
+// contributors returns peers who provided some chunks, sorted by number of
+// provided chunks to decreasing order
+func (d *chunkDownload) contributors() []peer.ID {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	peers := make([]peer.ID, 0, len(d.fetched))
+	for p := range d.fetched {
+		peers = append(peers, p)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return d.fetched[peers[i]] > d.fetched[peers[j]]
+	})
+	return peers
+}
+
+func (fs *FileShareProtocol) createP2PFileDownloadReq(fileCid cid.Cid, chunks []uint32, onlyManifest, weakHashes bool) (*pb.FileDownloadRequest, error) {
+	msgMetaData, err := fs.NewProtoMetaData()
+	if err != nil {
+		return nil, errors.WithMessage(err, "error generating new proto metadata: ")
+	}
+
+	protoMsg := &pb.FileDownloadRequest{
+		Metadata:     msgMetaData,
+		Cid:          fileCid.String(),
+		Chunks:       chunks,
+		OnlyManifest: onlyManifest,
+		Compressions: fs.compressions,
+		WeakHashes:   weakHashes,
+	}
+	signature, err := fs.SignProtoMessage(protoMsg)
+	if err != nil {
+		return nil, errors.WithMessage(err, "error generating signature for new file download request: ")
+	}
+	protoMsg.Metadata.Signature = signature
+	return protoMsg, err
+}
+
+// downloadFile downloads the file of the job from given providers and returns
+// its path together with peers who provided it
+func (fs *FileShareProtocol) downloadFile(job *downloadJob, providers []peer.AddrInfo, meta *files.FileMeta) (string, []peer.ID, error) {
+	// TODO maybe I have to firstly run Connect(peer)? or maybe at least put addrInfo to peer book?
+	// 	    So it does not have to be found in DHTs
+	peers := make([]peer.ID, 0, len(providers))
+	for _, p := range providers {
+		peers = append(peers, p.ID)
+	}
+	manifest, peers := fs.fetchManifest(job, peers, meta)
+	if manifest == nil {
+		return "", nil, errors.Errorf("no provider of %s provided valid manifest", job.fileCid.String())
+	}
+	hashes := manifest.ChunkHashes
+	d, err := fs.openChunkDownload(job, meta, hashes)
+	if err != nil {
+		return "", nil, errors.Errorf("error opening partial file of %s: %s", job.fileCid.String(), err)
+	}
+	defer func() {
+		_ = d.file.Close()
+	}()
+	if job.basePath != "" && d.remaining() > 0 {
+		fs.copyChunksFromBase(d, job.basePath, manifest.WeakHashes)
+	}
+
+	for d.remaining() > 0 && len(peers) > 0 && !job.cancelled() {
+		before := d.remaining()
+		peers = fs.downloadChunks(d, peers)
+		if d.remaining() == before {
+			// no provider was able to provide anything
+			break
+		}
+	}
+	if d.remaining() > 0 {
+		return "", nil, errors.Errorf("download of %s is not complete, %d chunks are missing, progress is kept in %s",
+			job.fileCid.String(), d.remaining(), d.file.Name())
+	}
+
+	path, err := fs.finishChunkDownload(d)
+	if err != nil {
+		return "", nil, errors.Errorf("error finishing download of %s: %s", job.fileCid.String(), err)
+	}
+	fs.fileBook.SetDownloaded(&job.fileCid, path, hashes)
+	return path, d.contributors(), nil
+}
+
+// fetchManifest asks providers one by one for the manifest of the file until
+// one of them provides valid one. It returns the manifest and providers which
+// did not misbehave. Weak hashes are requested when there is a base version
+// of the file to look for chunks in
+func (fs *FileShareProtocol) fetchManifest(job *downloadJob, providers []peer.ID, meta *files.FileMeta) (*pb.FileManifest, []peer.ID) {
+	reqMsg, err := fs.createP2PFileDownloadReq(job.fileCid, nil, true, job.basePath != "")
+	if err != nil {
+		log.Errorf("error generationg file manifest req: %s", err)
+		return nil, nil
+	}
+
+	for i, p := range providers {
+		if job.cancelled() {
+			break
+		}
+		s, err := fs.InitiateStream(p, p2pFileShareDownloadProtocol, reqMsg)
+		if err != nil {
+			log.Errorf("error sending manifest req to %s: %s", p.String(), err)
+			continue
+		}
+		_ = s.CloseWrite()
+		stopReset := job.resetOnCancel(s)
+		manifest, err := fs.readManifest(bufio.NewReader(s), p, meta)
+		stopReset()
+		_ = s.Close()
+		if err != nil {
+			log.Error(err)
+			continue
+		}
+		return manifest, providers[i:]
+	}
+	return nil, nil
+}
+
+// readManifest reads the manifest from the stream and verifies it. Provider
+// of invalid manifest is reported
+func (fs *FileShareProtocol) readManifest(r *bufio.Reader, p peer.ID, meta *files.FileMeta) (*pb.FileManifest, error) {
+	manifest := &pb.FileManifest{}
+	err := fs.ReadDelimitedProtoMsg(r, manifest, maxManifestSize)
+	if err != nil {
+		return nil, errors.Errorf("error reading manifest from %s: %s", p.String(), err)
+	}
+	err = fs.AuthenticateMessage(manifest, manifest.Metadata)
+	if err != nil {
+		return nil, errors.Errorf("error authenticating manifest from %s: %s", p.String(), err)
+	}
+	if manifest.Status != "OK" {
+		return nil, errors.Errorf("peer %s refused to provide the file: %s", p.String(), manifest.Status)
+	}
+	if err = fs.verifyManifest(manifest, meta); err != nil {
+		fs.reportFileProvider(p, "provided invalid file manifest")
+		return nil, errors.Errorf("peer %s provided invalid manifest: %s", p.String(), err)
+	}
+	return manifest, nil
+}
+
+// openChunkDownload opens (or creates) partial file of the download. Chunks
+// already present in the partial file are verified against the manifest, so
+// only missing or corrupted chunks are downloaded again
+func (fs *FileShareProtocol) openChunkDownload(job *downloadJob, meta *files.FileMeta, hashes [][]byte) (*chunkDownload, error) {
+	fileCid := job.fileCid
+	f, err := os.OpenFile(fs.filePath(fileCid)+partSuffix, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err = f.Truncate(meta.Size); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	d := &chunkDownload{
+		job:     job,
+		fileCid: fileCid,
+		meta:    meta,
+		hashes:  hashes,
+		file:    f,
+		fetched: make(map[peer.ID]int),
+	}
+	buf := make([]byte, meta.ChunkSize)
+	for i, hash := range hashes {
+		n, err := f.ReadAt(buf, int64(i)*meta.ChunkSize)
+		if err != nil && err != io.EOF {
+			_ = f.Close()
+			return nil, err
+		}
+		if !bytes.Equal(files.ChunkHash(buf[:n]), hash) {
+			d.missing = append(d.missing, uint32(i))
+		}
+	}
+	job.setProgress(len(hashes)-len(d.missing), len(hashes))
+	if done := len(hashes) - len(d.missing); done > 0 {
+		log.Infof("resuming download of %s, %d/%d chunks already downloaded", fileCid.String(), done, len(hashes))
+	}
+	return d, nil
+}
+
+// copyChunksFromBase copies missing chunks found in locally available base
+// version of the file into the partial file, so only changed chunks have to
+// be downloaded. Chunks are looked for at the same position and, if weak
+// hashes are known, also at shifted positions
+func (fs *FileShareProtocol) copyChunksFromBase(d *chunkDownload, basePath string, weak []uint32) {
+	missing := d.take(d.remaining())
+	base, err := os.Open(basePath)
+	if err != nil {
+		log.Errorf("error opening base version %s: %s", basePath, err)
+		d.giveBack(missing)
+		return
+	}
+	defer func() {
+		_ = base.Close()
+	}()
+
+	chunkSize := d.meta.ChunkSize
+	chunkLen := func(index uint32) int64 {
+		if rest := d.meta.Size - int64(index)*chunkSize; rest < chunkSize {
+			return rest
+		}
+		return chunkSize
+	}
+	buf := make([]byte, chunkSize)
+	offsets := make(map[uint32]int64)
+	shifted := make([]uint32, 0)
+	for _, index := range missing {
+		offset := int64(index) * chunkSize
+		n, _ := base.ReadAt(buf[:chunkLen(index)], offset)
+		if int64(n) == chunkLen(index) && bytes.Equal(files.ChunkHash(buf[:n]), d.hashes[index]) {
+			offsets[index] = offset
+		} else if chunkLen(index) == chunkSize {
+			shifted = append(shifted, index)
+		}
+	}
+	// weak hashes are only hints, found chunks are verified by chunk hashes
+	if len(weak) == len(d.hashes) && len(shifted) > 0 {
+		found, err := files.FindChunks(basePath, chunkSize, weak, d.hashes, shifted)
+		if err != nil {
+			log.Errorf("error searching chunks in base version %s: %s", basePath, err)
+		}
+		for index, offset := range found {
+			offsets[index] = offset
+		}
+	}
+
+	notFound := make([]uint32, 0, len(missing)-len(offsets))
+	for _, index := range missing {
+		offset, ok := offsets[index]
+		if !ok {
+			notFound = append(notFound, index)
+			continue
+		}
+		n, err := base.ReadAt(buf[:chunkLen(index)], offset)
+		if err == nil {
+			_, err = d.file.WriteAt(buf[:n], int64(index)*chunkSize)
+		}
+		if err != nil {
+			log.Errorf("error copying chunk %d from base version %s: %s", index, basePath, err)
+			notFound = append(notFound, index)
+			continue
+		}
+		d.job.chunkDownloaded()
+	}
+	d.giveBack(notFound)
+	log.Infof("%d of %d missing chunks of %s found in base version %s", len(missing)-len(notFound),
+		len(missing), d.fileCid.String(), basePath)
+}
+
+// downloadChunks downloads missing chunks from providers in parallel. It
+// returns providers which did not fail, so they can be used in next round
+func (fs *FileShareProtocol) downloadChunks(d *chunkDownload, providers []peer.ID) []peer.ID {
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	healthy := make([]peer.ID, 0, len(providers))
+	slots := make(chan struct{}, fs.maxParallelProviders)
+
+	for _, p := range providers {
+		wg.Add(1)
+		go func(p peer.ID) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			for !d.job.cancelled() {
+				batch := d.take(fs.chunksPerRequest)
+				if len(batch) == 0 {
+					break
+				}
+				notFetched, err := fs.fetchChunks(d, p, batch)
+				if err != nil {
+					log.Errorf("error downloading chunks of %s from %s: %s", d.fileCid.String(), p.String(), err)
+					d.giveBack(notFetched)
+					return
+				}
+				fs.notifyTLAboutProgress(d.job)
+			}
+			lock.Lock()
+			healthy = append(healthy, p)
+			lock.Unlock()
+		}(p)
+	}
+	wg.Wait()
+	return healthy
+}
+
+// fetchChunks downloads given chunks from the provider and writes them into
+// the partial file. It returns chunks which were not fetched
+func (fs *FileShareProtocol) fetchChunks(d *chunkDownload, p peer.ID, batch []uint32) ([]uint32, error) {
+	log.Debugf("downloading %d chunks of %s from %s", len(batch), d.fileCid.String(), p.String())
+	reqMsg, err := fs.createP2PFileDownloadReq(d.fileCid, batch, false, false)
+	if err != nil {
+		return batch, err
+	}
+	s, err := fs.InitiateStream(p, p2pFileShareDownloadProtocol, reqMsg)
+	if err != nil {
+		return batch, errors.Errorf("error sending req to %s: %s", p.String(), err)
+	}
+	_ = s.CloseWrite()
+	defer s.Close()
+	defer d.job.resetOnCancel(s)()
+	r := bufio.NewReader(s)
+
+	manifest, err := fs.readManifest(r, p, d.meta)
+	if err != nil {
+		return batch, err
+	}
+	maxChunkMsg := int(d.meta.ChunkSize) + maxManifestOverhead
+	for i, index := range batch {
+		chunk := &pb.FileChunk{}
+		err = fs.ReadDelimitedProtoMsg(r, chunk, maxChunkMsg)
+		if err != nil {
+			return batch[i:], errors.Errorf("error reading chunk %d: %s", index, err)
+		}
+		data, err := chunkData(chunk, manifest.Compression, d.meta.ChunkSize)
+		if err != nil || chunk.Index != index || !bytes.Equal(files.ChunkHash(data), d.hashes[index]) {
+			fs.reportFileProvider(p, "provided file chunk with not matching hash")
+			return batch[i:], errors.Errorf("peer %s provided not matching chunk %d!", p.String(), index)
+		}
+		if err = d.writeChunk(index, data, p); err != nil {
+			return batch[i:], err
+		}
+	}
+	return nil, nil
+}
+
+// finishChunkDownload checks cid of the downloaded file and moves it from the
+// partial file to its final path
+func (fs *FileShareProtocol) finishChunkDownload(d *chunkDownload) (string, error) {
+	partPath := d.file.Name()
+	if err := d.file.Sync(); err != nil {
+		return "", err
+	}
+	receivedCid, err := files.GetFileCid(partPath)
+	if err != nil {
+		return "", err
+	}
+	if !receivedCid.Equals(d.fileCid) {
+		// all chunks matched the manifest signed by the author, so the file
+		// cannot be repaired by downloading it again
+		_ = os.Remove(partPath)
+		return "", errors.Errorf("downloaded file has cid %s instead of %s", receivedCid.String(), d.fileCid.String())
+	}
+	path := fs.filePath(d.fileCid)
+	if err = os.Rename(partPath, path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// chunkData returns decompressed data of the chunk. Decompressed data larger
+// than chunk size are refused
+func chunkData(chunk *pb.FileChunk, compression string, chunkSize int64) ([]byte, error) {
+	if !chunk.Compressed {
+		return chunk.Data, nil
+	}
+	if compression == "" {
+		return nil, errors.New("chunk is compressed but no compression was selected")
+	}
+	return files.Decompress(compression, chunk.Data, chunkSize)
+}
+
+// verifyManifest checks that manifest describes the file announced by its author
+func (fs *FileShareProtocol) verifyManifest(manifest *pb.FileManifest, meta *files.FileMeta) error {
+	if err := fs.checkChunking(manifest.Size, manifest.ChunkSize); err != nil {
+		return err
+	}
+	if manifest.Size != meta.Size || manifest.ChunkSize != meta.ChunkSize {
+		return errors.Errorf("size %d or chunk size %d differ from the announced ones", manifest.Size, manifest.ChunkSize)
+	}
+	if len(manifest.ChunkHashes) != files.NumberOfChunks(manifest.Size, manifest.ChunkSize) {
+		return errors.Errorf("%d chunk hashes do not match file size %d", len(manifest.ChunkHashes), manifest.Size)
+	}
+	if !bytes.Equal(files.ChunksRoot(manifest.ChunkHashes), meta.ChunksRoot) {
+		return errors.New("chunk hashes do not match the announced ones")
+	}
+	return nil
+}
+
+// checkChunkSize refuses chunk sizes which are not positive or which are
+// larger than configured maximum, so remote peers cannot make us allocate
+// arbitrarily large buffers
+func (fs *FileShareProtocol) checkChunkSize(chunkSize int64) error {
+	if chunkSize <= 0 || chunkSize > fs.maxChunkSize {
+		return errors.Errorf("invalid chunk size %d, max is %d", chunkSize, fs.maxChunkSize)
+	}
+	return nil
+}
+
+// checkChunking refuses files with invalid chunk size or with more than
+// maxChunks chunks, so tiny chunks cannot make manifests and downloads huge
+func (fs *FileShareProtocol) checkChunking(size, chunkSize int64) error {
+	if err := fs.checkChunkSize(chunkSize); err != nil {
+		return err
+	}
+	if size < 0 || size > chunkSize*maxChunks {
+		return errors.Errorf("invalid size %d of file with chunk size %d, max is %d chunks", size, chunkSize, maxChunks)
+	}
+	return nil
+}
+
+func (fs *FileShareProtocol) reportFileProvider(p peer.ID, reason string) {
+	err := fs.ReportPeer(p, reason)
+	if err != nil {
+		log.Errorf("error reporting peer: %s", err)
+	}
+}
+
+// partSuffix is appended to path of a file while it is being downloaded
+const partSuffix = ".part"
+
+func (fs *FileShareProtocol) filePath(fileCid cid.Cid) string {
+	return fmt.Sprintf("%s/%s", fs.downloadDir, fileCid.String())
+}
@@ -0,0 +1,235 @@
+package protocols
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/pkg/errors"
+
+	"happystoic/p2pnetwork/pkg/files"
+	"happystoic/p2pnetwork/pkg/messaging/pb"
+	"happystoic/p2pnetwork/pkg/messaging/utils"
+)
+
+// heads of my feeds are published in DHT shortly after start, when the node
+// is connected, and then periodically before DHT records expire
+const (
+	feedHeadFirstPublish    = time.Minute
+	feedHeadRepublishPeriod = 12 * time.Hour
+	feedResolveTimeout      = 30 * time.Second
+)
+
+type Nl2TlRedisFileShareUpdated struct {
+	Feed           string             `json:"feed"`
+	Version        uint64             `json:"version"`
+	FileId         string             `json:"file_id"`
+	PreviousFileId string             `json:"previous_file_id"`
+	Severity       string             `json:"severity"`
+	Sender         utils.PeerMetadata `json:"sender"`
+	Description    interface{}        `json:"description"`
+}
+
+// setNextFeedVersion makes the file announced by TL the next version of my
+// feed with given name. Versions are sequence numbers persisted in the feed
+// store, so they keep increasing and point to the previous version also after
+// restart of the node
+func (fs *FileShareProtocol) setNextFeedVersion(fileCid cid.Cid, meta *files.FileMeta, name string) error {
+	meta.Feed, meta.Version, meta.PreviousCid = files.FeedId(fs.Host.ID(), name), 1, cid.Undef
+
+	state, exists := fs.feedStore.Get(name)
+	if !exists {
+		return nil
+	}
+	if state.Cid == fileCid.String() {
+		return errors.Errorf("file %s is already the latest version of feed %s", fileCid.String(), meta.Feed)
+	}
+	previous, err := cid.Decode(state.Cid)
+	if err != nil {
+		return errors.WithMessage(err, "error decoding cid of previous version of feed: ")
+	}
+	meta.Version, meta.PreviousCid = state.Sequence+1, previous
+	return nil
+}
+
+// publishFeedHead persists new version of my feed and publishes signed head
+// of the feed in DHT. Metadata of files without rights are part of the head,
+// so peers can download the latest version right after resolving the feed
+func (fs *FileShareProtocol) publishFeedHead(name string, msg *pb.FileMetadata, meta *files.FileMeta) error {
+	msgMetaData, err := fs.NewProtoMetaData()
+	if err != nil {
+		return errors.WithMessage(err, "error generating new proto metadata: ")
+	}
+	head := &pb.FeedHead{
+		Metadata: msgMetaData,
+		Feed:     meta.Feed,
+		Sequence: meta.Version,
+		Cid:      msg.Cid,
+	}
+	if len(meta.Rights) == 0 {
+		head.FileMetadata = msg
+	}
+	signature, err := fs.SignProtoMessage(head)
+	if err != nil {
+		return errors.WithMessage(err, "error generating signature for feed head: ")
+	}
+	head.Metadata.Signature = signature
+
+	data, err := proto.Marshal(head)
+	if err != nil {
+		return err
+	}
+	// version is persisted before it leaves the node, so it is never reused
+	err = fs.feedStore.Set(name, files.FeedState{Sequence: head.Sequence, Cid: head.Cid, Head: data})
+	if err != nil {
+		return errors.WithMessage(err, "error persisting feed: ")
+	}
+	go fs.putFeedHead(head)
+	return nil
+}
+
+func (fs *FileShareProtocol) putFeedHead(head *pb.FeedHead) {
+	err := fs.dht.PutFeedHead(head)
+	if err != nil {
+		log.Errorf("error publishing head of feed %s in dht: %s", head.Feed, err)
+		return
+	}
+	log.Debugf("published version %d of feed %s in dht", head.Sequence, head.Feed)
+}
+
+// republishFeedHeads periodically stores heads of my feeds in DHT again, as
+// DHT records expire
+func (fs *FileShareProtocol) republishFeedHeads() {
+	timer := time.NewTimer(feedHeadFirstPublish)
+	defer timer.Stop()
+	for {
+		select {
+		case <-fs.ctx.Done():
+			return
+		case <-timer.C:
+			for name, state := range fs.feedStore.All() {
+				head := &pb.FeedHead{}
+				if err := proto.Unmarshal(state.Head, head); err != nil {
+					log.Errorf("error decoding stored head of feed %s: %s", name, err)
+					continue
+				}
+				fs.putFeedHead(head)
+			}
+			timer.Reset(feedHeadRepublishPeriod)
+		}
+	}
+}
+
+// checkFeedVersion checks that received version of the feed was published by
+// the author of the feed and that it is newer than the latest known version
+func (fs *FileShareProtocol) checkFeedVersion(meta *files.FileMeta, author peer.ID) error {
+	feedAuthor, _, err := files.ParseFeedId(meta.Feed)
+	if err != nil {
+		return err
+	}
+	if feedAuthor != author {
+		return errors.Errorf("version of feed %s published by %s who is not its author", meta.Feed, author)
+	}
+	if latest, exists := fs.feeds.Latest(meta.Feed); exists && latest.Version >= meta.Version {
+		return errors.Errorf("version %d of feed %s is not newer than known version %d",
+			meta.Version, meta.Feed, latest.Version)
+	}
+	return nil
+}
+
+type Tl2NlRedisFileShareFeedResolve struct {
+	Feed string `json:"feed"`
+}
+
+type Nl2TlRedisFileShareFeedHead struct {
+	Feed           string `json:"feed"`
+	Version        uint64 `json:"version"`
+	FileId         string `json:"file_id"`
+	PreviousFileId string `json:"previous_file_id"`
+	// MetadataKnown tells whether metadata of the file are known, so TL can
+	// download it
+	MetadataKnown bool   `json:"metadata_known"`
+	Error         string `json:"error"`
+}
+
+// onFeedResolve resolves the latest version of the feed in DHT and sends it
+// to TL
+func (fs *FileShareProtocol) onFeedResolve(data []byte) {
+	req := Tl2NlRedisFileShareFeedResolve{}
+	err := json.Unmarshal(data, &req)
+	if err != nil {
+		log.Errorf("error unmarshalling Tl2NlRedisFileShareFeedResolve from redis: %s", err)
+		return
+	}
+	go func() {
+		msg, err := fs.resolveFeed(req.Feed)
+		if err != nil {
+			log.Errorf("error resolving feed %s: %s", req.Feed, err)
+			msg = Nl2TlRedisFileShareFeedHead{Feed: req.Feed, Error: err.Error()}
+		}
+		err = fs.RedisClient.PublishMessage("nl2tl_file_share_feed_head", msg)
+		if err != nil {
+			log.Errorf("error sending feed head to redis: %s", err)
+		}
+	}()
+}
+
+func (fs *FileShareProtocol) resolveFeed(feed string) (Nl2TlRedisFileShareFeedHead, error) {
+	msg := Nl2TlRedisFileShareFeedHead{Feed: feed}
+	if _, _, err := files.ParseFeedId(feed); err != nil {
+		return msg, err
+	}
+	ctx, cancel := context.WithTimeout(fs.ctx, feedResolveTimeout)
+	defer cancel()
+	head, err := fs.dht.GetFeedHead(ctx, feed)
+	if err != nil {
+		return msg, err
+	}
+	fileCid, err := cid.Decode(head.Cid)
+	if err != nil {
+		return msg, errors.WithMessage(err, "error decoding cid of feed head: ")
+	}
+	msg.Version, msg.FileId = head.Sequence, head.Cid
+
+	if head.FileMetadata != nil && fs.fileBook.Snapshot(&fileCid) == nil {
+		meta, err := fs.fileMetaFromP2P(head.FileMetadata)
+		if err != nil {
+			return msg, errors.WithMessage(err, "error creating metadata from feed head: ")
+		}
+		if !meta.IsExpired() {
+			if err = fs.fileBook.AddFile(&fileCid, meta); err != nil {
+				log.Debugf("metadata of file %s from feed head not added: %s", head.Cid, err)
+			}
+		}
+	}
+	if meta := fs.fileBook.Snapshot(&fileCid); meta != nil {
+		msg.MetadataKnown = true
+		if meta.PreviousCid.Defined() {
+			msg.PreviousFileId = meta.PreviousCid.String()
+		}
+	}
+	fs.feeds.Update(feed, files.FeedVersion{Version: head.Sequence, Cid: fileCid})
+	return msg, nil
+}
+
+func (fs *FileShareProtocol) updateFeed(fileCid cid.Cid, meta *files.FileMeta) bool {
+	return fs.feeds.Update(meta.Feed, files.FeedVersion{Version: meta.Version, Cid: fileCid})
+}
+
+func (fs *FileShareProtocol) notifyTLAboutUpdate(fileCid cid.Cid, author peer.ID, meta *files.FileMeta) error {
+	msg := Nl2TlRedisFileShareUpdated{
+		Feed:        meta.Feed,
+		Version:     meta.Version,
+		FileId:      fileCid.String(),
+		Severity:    meta.Severity.String(),
+		Sender:      fs.MetadataOfPeer(author),
+		Description: meta.Description,
+	}
+	if meta.PreviousCid.Defined() {
+		msg.PreviousFileId = meta.PreviousCid.String()
+	}
+	return fs.RedisClient.PublishMessage("nl2tl_file_share_updated", msg)
+}
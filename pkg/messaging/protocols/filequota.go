@@ -0,0 +1,226 @@
+package protocols
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/pkg/errors"
+
+	"happystoic/p2pnetwork/pkg/files"
+)
+
+type Nl2TlRedisFileShareEvicted struct {
+	FileId string `json:"file_id"`
+	Path   string `json:"path"`
+}
+
+// downloadDirFile is a file in the download directory named after cid of a
+// downloaded file or of its partial download
+type downloadDirFile struct {
+	cid     cid.Cid
+	path    string
+	size    int64
+	modTime time.Time
+	partial bool
+}
+
+// reserveSpace checks limits of a download of the file with given size and
+// reserves space for it in the download directory quota. Files not known to
+// the file book and then the least recently used downloaded files are evicted
+// when the quota would be exceeded
+func (fs *FileShareProtocol) reserveSpace(fileCid cid.Cid, size int64) error {
+	if size > fs.maxFileSize {
+		return errors.Errorf("file %s has %d bytes, max allowed file size is %d bytes",
+			fileCid.String(), size, fs.maxFileSize)
+	}
+	if size > fs.maxDownloadSize {
+		return errors.Errorf("file %s has %d bytes, max allowed download size is %d bytes",
+			fileCid.String(), size, fs.maxDownloadSize)
+	}
+
+	fs.quotaLock.Lock()
+	defer fs.quotaLock.Unlock()
+
+	// reserve the space first, so partial download of the file is not evicted
+	fs.reserved[fileCid] = size
+	err := fs.makeSpace(fileCid, size)
+	if err != nil {
+		delete(fs.reserved, fileCid)
+	}
+	return err
+}
+
+// makeSpace evicts files until the reserved space fits into the quota and
+// checks there is enough free disk space. quotaLock must be held
+func (fs *FileShareProtocol) makeSpace(fileCid cid.Cid, size int64) error {
+	for {
+		dirFiles, err := fs.scanDownloadDir()
+		if err != nil {
+			return errors.WithMessage(err, "error reading download directory: ")
+		}
+		if fs.usedSpace(dirFiles) <= fs.downloadDirQuota {
+			// part of the file might be already downloaded
+			missing := size - partialSize(dirFiles, fileCid)
+			free, err := files.FreeDiskSpace(fs.downloadDir)
+			if err != nil {
+				return errors.WithMessage(err, "error getting free disk space: ")
+			}
+			if int64(free)-missing < fs.minFreeDiskSpace {
+				return errors.Errorf("not enough free disk space for file %s with %d bytes, %d bytes are free",
+					fileCid.String(), size, free)
+			}
+			return nil
+		}
+		evicted, err := fs.evictOne(dirFiles)
+		if err != nil {
+			return err
+		}
+		if !evicted {
+			return errors.Errorf("file %s with %d bytes does not fit into download directory quota %d bytes",
+				fileCid.String(), size, fs.downloadDirQuota)
+		}
+	}
+}
+
+func (fs *FileShareProtocol) releaseSpace(fileCid cid.Cid) {
+	fs.quotaLock.Lock()
+	defer fs.quotaLock.Unlock()
+	delete(fs.reserved, fileCid)
+}
+
+// scanDownloadDir returns downloaded and partially downloaded files in the
+// download directory, other files in the directory are ignored
+func (fs *FileShareProtocol) scanDownloadDir() ([]downloadDirFile, error) {
+	entries, err := os.ReadDir(fs.downloadDir)
+	if err != nil {
+		return nil, err
+	}
+	dirFiles := make([]downloadDirFile, 0)
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		name := entry.Name()
+		c, err := cid.Decode(strings.TrimSuffix(name, partSuffix))
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// file was deleted meanwhile
+			continue
+		}
+		f := downloadDirFile{
+			cid:     c,
+			path:    fs.filePath(c),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+			partial: strings.HasSuffix(name, partSuffix),
+		}
+		if f.partial {
+			f.path += partSuffix
+		}
+		dirFiles = append(dirFiles, f)
+	}
+	return dirFiles, nil
+}
+
+// usedSpace returns size of files in the download directory and the space
+// reserved for running downloads which is not written yet. quotaLock must
+// be held
+func (fs *FileShareProtocol) usedSpace(dirFiles []downloadDirFile) int64 {
+	var used int64
+	for _, f := range dirFiles {
+		used += f.size
+	}
+	for c, size := range fs.reserved {
+		if missing := size - partialSize(dirFiles, c); missing > 0 {
+			used += missing
+		}
+	}
+	return used
+}
+
+// partialSize returns size of partial download of the file
+func partialSize(dirFiles []downloadDirFile, fileCid cid.Cid) int64 {
+	for _, f := range dirFiles {
+		if f.partial && f.cid.Equals(fileCid) {
+			return f.size
+		}
+	}
+	return 0
+}
+
+// isTracked tells whether the file belongs to a running download or is
+// a downloaded file known to the file book
+func (fs *FileShareProtocol) isTracked(f *downloadDirFile) bool {
+	if _, running := fs.reserved[f.cid]; running {
+		return true
+	}
+	if f.partial {
+		return false
+	}
+	meta := fs.fileBook.Snapshot(&f.cid)
+	return meta != nil && meta.Downloaded && meta.Available && meta.Path == f.path
+}
+
+// evictOne deletes one file to free space in the download directory. The
+// oldest file not tracked by the file book is deleted first, e.g. a file left
+// from before restart or stale partial download. Downloaded files are evicted
+// then, expired and least recently used ones first. quotaLock must be held
+func (fs *FileShareProtocol) evictOne(dirFiles []downloadDirFile) (bool, error) {
+	var untracked *downloadDirFile
+	for i := range dirFiles {
+		f := &dirFiles[i]
+		if !fs.isTracked(f) && (untracked == nil || f.modTime.Before(untracked.modTime)) {
+			untracked = f
+		}
+	}
+	if untracked != nil {
+		log.Infof("evicting file %s not tracked in file book", untracked.path)
+		err := os.Remove(untracked.path)
+		if err != nil && !os.IsNotExist(err) {
+			return false, errors.Errorf("error deleting evicted file %s: %s", untracked.path, err)
+		}
+		return true, nil
+	}
+	for _, c := range fs.fileBook.DownloadedFiles() {
+		if _, running := fs.reserved[c]; !running {
+			fs.evictFile(c)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// evictFile deletes downloaded file to free space in the download directory
+// and tells TL about it
+func (fs *FileShareProtocol) evictFile(fileCid cid.Cid) {
+	meta := fs.fileBook.Snapshot(&fileCid)
+	if meta == nil {
+		return
+	}
+	path := meta.Path
+	log.Infof("evicting downloaded file %s from %s", fileCid.String(), path)
+	err := os.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		log.Errorf("error deleting evicted file %s: %s", path, err)
+	}
+	if meta.Expired {
+		fs.fileBook.Remove(&fileCid)
+	} else {
+		fs.fileBook.SetUnavailable(&fileCid)
+	}
+	fs.forgetDownloadJob(fileCid)
+
+	msg := Nl2TlRedisFileShareEvicted{
+		FileId: fileCid.String(),
+		Path:   path,
+	}
+	err = fs.RedisClient.PublishMessage("nl2tl_file_share_evicted", msg)
+	if err != nil {
+		log.Errorf("error sending file eviction to redis: %s", err)
+	}
+}
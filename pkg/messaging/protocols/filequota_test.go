@@ -0,0 +1,86 @@
+package protocols
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+
+	"happystoic/p2pnetwork/pkg/files"
+)
+
+func newQuotaTestProtocol(t *testing.T, quota int64) *FileShareProtocol {
+	return &FileShareProtocol{
+		downloadDir:      t.TempDir(),
+		maxFileSize:      quota,
+		maxDownloadSize:  quota,
+		downloadDirQuota: quota,
+		reserved:         make(map[cid.Cid]int64),
+		fileBook:         files.NewFileBook(),
+	}
+}
+
+func testFileCid(t *testing.T, name string) cid.Cid {
+	c, err := files.GetBytesCid([]byte(name))
+	if err != nil {
+		t.Fatalf("error computing cid: %s", err)
+	}
+	return *c
+}
+
+func writeDownloadDirFile(t *testing.T, path string, size int, modTime time.Time) {
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatalf("error writing file: %s", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("error setting file times: %s", err)
+	}
+}
+
+func TestReserveSpaceCountsPartialDownload(t *testing.T) {
+	fs := newQuotaTestProtocol(t, 100)
+	downloading := testFileCid(t, "downloading")
+	// the first half of the file was downloaded before restart
+	writeDownloadDirFile(t, fs.filePath(downloading)+partSuffix, 50, time.Now())
+
+	if err := fs.reserveSpace(downloading, 100); err != nil {
+		t.Fatalf("error reserving space: %s", err)
+	}
+	dirFiles, err := fs.scanDownloadDir()
+	if err != nil {
+		t.Fatalf("error scanning download directory: %s", err)
+	}
+	if used := fs.usedSpace(dirFiles); used != 100 {
+		t.Fatalf("used space is %d, expected 100", used)
+	}
+	if _, err = os.Stat(fs.filePath(downloading) + partSuffix); err != nil {
+		t.Fatalf("partial download of reserved file was evicted: %s", err)
+	}
+	if err = fs.reserveSpace(testFileCid(t, "other"), 1); err == nil {
+		t.Fatal("space over quota was reserved")
+	}
+}
+
+func TestReserveSpaceEvictsUntrackedFiles(t *testing.T) {
+	fs := newQuotaTestProtocol(t, 100)
+	old, newer := testFileCid(t, "old"), testFileCid(t, "newer")
+	// files left from before restart, they are not in the file book
+	writeDownloadDirFile(t, fs.filePath(old), 40, time.Now().Add(-time.Hour))
+	writeDownloadDirFile(t, fs.filePath(newer)+partSuffix, 40, time.Now())
+	// file not named after cid is not counted
+	writeDownloadDirFile(t, fs.downloadDir+"/other", 1000, time.Now())
+
+	if err := fs.reserveSpace(testFileCid(t, "new"), 50); err != nil {
+		t.Fatalf("error reserving space: %s", err)
+	}
+	if _, err := os.Stat(fs.filePath(old)); !os.IsNotExist(err) {
+		t.Fatalf("the oldest untracked file was not evicted: %v", err)
+	}
+	if _, err := os.Stat(fs.filePath(newer) + partSuffix); err != nil {
+		t.Fatalf("newer untracked file was evicted: %s", err)
+	}
+	if _, err := os.Stat(fs.downloadDir + "/other"); err != nil {
+		t.Fatalf("file not named after cid was evicted: %s", err)
+	}
+}
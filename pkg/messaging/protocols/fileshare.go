@@ -1,13 +1,15 @@
 package protocols
 
 import (
+	"bufio"
 	"context"
+	"crypto/rand"
 	"encoding/json"
-	"fmt"
+	"io"
 	"os"
+	"sync"
 	"time"
 
-	"github.com/golang/protobuf/proto"
 	"github.com/ipfs/go-cid"
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
@@ -23,17 +25,53 @@ import (
 
 // p2p protocol definition
 const p2pFileShareMetadataProtocol = "/fileShare-metadata/0.0.1"
-const p2pFileShareDownloadProtocol = "/fileShare-download/0.0.1"
+const p2pFileShareDownloadProtocol = "/fileShare-download/0.0.2"
+
+// maxManifestOverhead is space reserved for metadata in manifest and chunk messages
+const maxManifestOverhead = 4096
+
+// maxChunks is max number of chunks of a shared file
+const maxChunks = 1 << 16
+
+// maxManifestSize is max size of manifest message, every chunk takes at most
+// 64 bytes (its hash and weak hash)
+const maxManifestSize = maxChunks*64 + maxManifestOverhead
+
+// providerKeySize is size of secret keys of files with rights
+const providerKeySize = 32
 
 // FileShareProtocol type
 type FileShareProtocol struct {
 	*utils.ProtoUtils
 
-	downloadDir string
-
-	fileBook *files.FileBook
-	dht      *ldht.Dht
-	spreader *Spreader
+	downloadDir          string
+	chunkSize            int64
+	maxChunkSize         int64
+	maxParallelProviders int
+	chunksPerRequest     int
+	deleteExpiredFiles   bool
+	maxFileSize          int64
+	maxDownloadSize      int64
+	downloadDirQuota     int64
+	minFreeDiskSpace     int64
+	compressions         []string
+	dropNonMatchingMeta  bool
+
+	quotaLock sync.Mutex
+	reserved  map[cid.Cid]int64
+
+	jobsLock sync.Mutex
+	jobs     map[cid.Cid]*downloadJob
+	ctx      context.Context
+
+	subsLock      sync.Mutex
+	subscriptions map[string]*fileSubscription
+
+	fileBook  *files.FileBook
+	feeds     *files.FeedBook
+	feedStore *files.FeedStore
+	dht       *ldht.Dht
+	spreader  *Spreader
 }
 
 type Tl2NlRedisFileShareAnnounce struct {
@@ -42,10 +80,14 @@ type Tl2NlRedisFileShareAnnounce struct {
 	Severity    string      `json:"severity"`
 	Path        string      `json:"path"`
 	Rights      []string    `json:"rights"`
+	Feed        string      `json:"feed"`
 }
 
 type Tl2NlRedisFileShareDownloadReq struct {
 	FileId string `json:"file_id"`
+	// BaseFileId is optional locally available version of the file, only
+	// chunks not found in it are downloaded
+	BaseFileId string `json:"base_file_id"`
 }
 
 type Nl2TlRedisFileShareMetadata struct {
@@ -56,22 +98,58 @@ type Nl2TlRedisFileShareMetadata struct {
 }
 
 type Nl2TlRedisFileShareDownloadDone struct {
-	FileId string             `json:"file_id"`
-	Path   string             `json:"path"`
-	Sender utils.PeerMetadata `json:"sender"`
+	FileId  string               `json:"file_id"`
+	Path    string               `json:"path"`
+	Sender  utils.PeerMetadata   `json:"sender"`
+	Senders []utils.PeerMetadata `json:"senders"`
 }
 
-func NewFileShareProtocol(ctx context.Context, pu *utils.ProtoUtils, fb *files.FileBook,
-	dht *ldht.Dht, cfg *config.FileShareSettings) *FileShareProtocol {
+type Nl2TlRedisFileShareExpired struct {
+	FileId  string `json:"file_id"`
+	Path    string `json:"path"`
+	Deleted bool   `json:"deleted"`
+}
 
-	spreader := NewSpreader(ctx, pu, cfg.MetaSpreadSettings)
+func NewFileShareProtocol(ctx context.Context, pu *utils.ProtoUtils, fb *files.FileBook, feedStore *files.FeedStore,
+	dht *ldht.Dht, cfg *config.FileShareSettings) *FileShareProtocol {
 
-	fs := &FileShareProtocol{pu, cfg.DownloadDir, fb, dht, spreader}
+	spreader := NewSpreader(ctx, pu, defaultFileMetaStrategies, cfg.MetaSpreadSettings)
+
+	fs := &FileShareProtocol{
+		ProtoUtils:           pu,
+		downloadDir:          cfg.DownloadDir,
+		chunkSize:            cfg.ChunkSize,
+		maxChunkSize:         cfg.MaxChunkSize,
+		maxParallelProviders: cfg.MaxParallelProviders,
+		chunksPerRequest:     cfg.ChunksPerRequest,
+		deleteExpiredFiles:   cfg.DeleteExpiredFiles,
+		maxFileSize:          cfg.MaxFileSize,
+		maxDownloadSize:      cfg.MaxDownloadSize,
+		downloadDirQuota:     cfg.DownloadDirQuota,
+		minFreeDiskSpace:     cfg.MinFreeDiskSpace,
+		compressions:         files.UsableCompressions(cfg.Compressions),
+		dropNonMatchingMeta:  cfg.DropNonMatchingMetadata,
+		subscriptions:        make(map[string]*fileSubscription),
+		reserved:             make(map[cid.Cid]int64),
+		jobs:                 make(map[cid.Cid]*downloadJob),
+		ctx:                  ctx,
+		fileBook:             fb,
+		feeds:                files.NewFeedBook(),
+		feedStore:            feedStore,
+		dht:                  dht,
+		spreader:             spreader,
+	}
 
 	_ = fs.RedisClient.SubscribeCallback("tl2nl_file_share", fs.onRedisFileAnnouncement)
 	_ = fs.RedisClient.SubscribeCallback("tl2nl_file_share_download", fs.onDownloadRequest)
+	_ = fs.RedisClient.SubscribeCallback("tl2nl_file_share_download_cancel", fs.onDownloadCancel)
+	_ = fs.RedisClient.SubscribeCallback("tl2nl_file_share_download_jobs", fs.onDownloadJobsQuery)
+	_ = fs.RedisClient.SubscribeCallback("tl2nl_file_share_subscribe", fs.onSubscribe)
+	_ = fs.RedisClient.SubscribeCallback("tl2nl_file_share_unsubscribe", fs.onUnsubscribe)
+	_ = fs.RedisClient.SubscribeCallback("tl2nl_file_share_feed_resolve", fs.onFeedResolve)
 	fs.Host.SetStreamHandler(p2pFileShareMetadataProtocol, fs.onP2PMetadata)
 	fs.Host.SetStreamHandler(p2pFileShareDownloadProtocol, fs.onP2PDownload)
+	go fs.republishFeedHeads()
 	return fs
 }
 
@@ -89,140 +167,171 @@ func (fs *FileShareProtocol) onDownloadRequest(data []byte) {
 		log.Errorf("error decoding file cid: %s", err)
 		return
 	}
-	meta := fs.fileBook.Get(&fileCid)
+	meta := fs.fileBook.Snapshot(&fileCid)
 	if meta == nil {
 		log.Errorf("file with cid %s has no stored metadata", fileCid.String())
 		return
 	}
 	if meta.Available && meta.Path != "" {
-		log.Errorf("file with cid %s is already available locally %s", fileCid.String(), meta.Path)
-		return
-	}
-	// TODO shall I also check if I have rights for the file? Or can I assume that?
-	providers, err := fs.dht.GetProvidersOf(fileCid)
-	if err != nil {
-		log.Errorf("error getting providers of file %s: %s", fileCid.String(), err)
+		log.Infof("file with cid %s is already available locally %s", fileCid.String(), meta.Path)
+		fs.fileBook.Touch(&fileCid)
+		fs.notifyTLAboutAvailableFile(fileCid, meta)
 		return
 	}
-	if len(providers) == 0 {
-		log.Errorf("Found no providers of %s in DHT", fileCid.String())
+	if meta.IsExpired() {
+		log.Errorf("file with cid %s has already expired", fileCid.String())
 		return
 	}
-	// sort providers based on their reliability to decreasing order
-	fs.ReliabilitySort(providers)
 
-	// now use the DHT to download the file
-	path, sender := fs.downloadFile(providers, fileCid)
-	if path == "" || sender == nil {
-		// we did not succeed
-		return
-	}
-	// tell TL where the file is downloaded
-	err = fs.notifyTLAboutDownload(fileCid, *sender, path)
-	if err != nil {
-		log.Errorf("error sending download confirmation to redis: %s", err)
+	job, started := fs.startDownloadJob(fileCid)
+	if !started {
+		log.Infof("file %s is already being downloaded, request joined the running download", fileCid.String())
 		return
 	}
-	meta.Available = true
-	meta.Path = path
-	err = fs.dht.StartProviding(fileCid) // todo maybe make this as option in config
-	if err != nil {
-		log.Errorf("error starting providing file in dht: %s", err)
-	}
-	log.Infof("successfully downloaded the file %s to path %s", fileCid.String(), path)
+	job.basePath = fs.deltaBase(meta, fileAnnouncement.BaseFileId)
+	go fs.runDownloadJob(job, meta)
 }
 
-func (fs *FileShareProtocol) createP2PFileDownloadReq(fileCid cid.Cid) (*pb.FileDownloadRequest, error) {
-	msgMetaData, err := fs.NewProtoMetaData()
-	if err != nil {
-		return nil, errors.WithMessage(err, "error generating new proto metadata: ")
+// deltaBase returns path of locally available version of the file which is
+// used as base for delta transfer. If TL does not specify the base, the
+// latest available previous version of the feed is used
+func (fs *FileShareProtocol) deltaBase(meta *files.FileMeta, baseId string) string {
+	if baseId != "" {
+		baseCid, err := cid.Decode(baseId)
+		if err != nil {
+			log.Errorf("error decoding base file cid: %s", err)
+			return ""
+		}
+		if base := fs.fileBook.Snapshot(&baseCid); base != nil && base.Available {
+			return base.Path
+		}
+		log.Errorf("base file %s is not available locally", baseId)
+		return ""
 	}
 
-	protoMsg := &pb.FileDownloadRequest{
-		Metadata: msgMetaData,
-		Cid:      fileCid.String(),
+	visited := make(map[cid.Cid]struct{})
+	for prev := meta.PreviousCid; prev.Defined(); {
+		if _, ok := visited[prev]; ok {
+			break
+		}
+		visited[prev] = struct{}{}
+		base := fs.fileBook.Snapshot(&prev)
+		if base == nil {
+			break
+		}
+		if base.Available && base.Path != "" {
+			return base.Path
+		}
+		prev = base.PreviousCid
 	}
-	signature, err := fs.SignProtoMessage(protoMsg)
+	return ""
+}
+
+// runDownloadJob downloads the file and keeps TL informed about the progress
+func (fs *FileShareProtocol) runDownloadJob(job *downloadJob, meta *files.FileMeta) {
+	fs.notifyTLAboutProgress(job)
+	err := fs.downloadJob(job, meta)
 	if err != nil {
-		return nil, errors.WithMessage(err, "error generating signature for new alert message: ")
+		log.Errorf("error downloading file %s: %s", job.fileCid.String(), err)
 	}
-	protoMsg.Metadata.Signature = signature
-	return protoMsg, err
+	job.finish(err)
+	fs.notifyTLAboutProgress(job)
 }
 
-func (fs *FileShareProtocol) tryFileProvider(msg proto.Message, p peer.ID, fileCid cid.Cid) (string, error) {
-	// TODO disconnect from him after he fails?
-	log.Debugf("trying to download %s from %s", fileCid.String(), p.String())
-
-	s, err := fs.InitiateStream(p, p2pFileShareDownloadProtocol, msg)
+func (fs *FileShareProtocol) downloadJob(job *downloadJob, meta *files.FileMeta) error {
+	fileCid := job.fileCid
+	err := fs.reserveSpace(fileCid, meta.Size)
 	if err != nil {
-		return "", errors.Errorf("error sending req to %s: %s", p.String(), err)
+		return errors.WithMessage(err, "download refused: ")
 	}
-	_ = s.CloseWrite()
-	defer s.Close()
+	defer fs.releaseSpace(fileCid)
 
-	resp := &pb.FileDownloadResponse{}
-	err = fs.DeserializeMessageFromStream(s, resp, false)
+	// TODO shall I also check if I have rights for the file? Or can I assume that?
+	providerCid, err := files.ProviderCid(fileCid, meta)
 	if err != nil {
-		return "", errors.Errorf("error reading response: %s", err)
+		return errors.Errorf("error deriving provider cid of file %s: %s", fileCid.String(), err)
 	}
-
-	err = fs.AuthenticateMessage(resp, resp.Metadata)
+	providers, err := fs.dht.GetProvidersOf(providerCid)
 	if err != nil {
-		return "", errors.Errorf("error authenticating response: %s", err)
+		return errors.Errorf("error getting providers of file %s: %s", fileCid.String(), err)
 	}
-
-	if len(resp.Data) == 0 {
-		return "", errors.Errorf("peer %s responded %s without data,", p.String(), resp.Status)
+	if len(providers) == 0 {
+		return errors.Errorf("found no providers of %s in DHT", fileCid.String())
 	}
+	// sort providers based on their reliability to decreasing order
+	fs.ReliabilitySort(providers)
 
-	// check if the hash (cid) actually matches
-	receivedCid, err := files.GetBytesCid(resp.Data)
-	if !receivedCid.Equals(fileCid) {
-		err = fs.ReportPeer(p, "provided file with not matching hash")
-		if err != nil {
-			log.Errorf("error reporting peer: %s", err)
-		}
-		return "", errors.Errorf("peer %s provided not matching file!", p.String())
+	// now use the DHT to download the file
+	path, senders, err := fs.downloadFile(job, providers, meta)
+	if err != nil {
+		return err
 	}
-
-	return fs.writeFile(fileCid, resp.Data)
+	// tell TL where the file is downloaded
+	err = fs.notifyTLAboutDownload(fileCid, senders, path)
+	if err != nil {
+		log.Errorf("error sending download confirmation to redis: %s", err)
+	}
+	err = fs.startProviding(fileCid, meta) // todo maybe make this as option in config
+	if err != nil {
+		log.Errorf("error starting providing file in dht: %s", err)
+	}
+	log.Infof("successfully downloaded the file %s to path %s", fileCid.String(), path)
+	return nil
 }
 
-func (fs *FileShareProtocol) writeFile(fileCid cid.Cid, data []byte) (string, error) {
-	path := fmt.Sprintf("%s/%s", fs.downloadDir, fileCid.String())
-	err := os.WriteFile(path, data, 0644)
+// startProviding announces in DHT that I am provider of the file
+func (fs *FileShareProtocol) startProviding(fileCid cid.Cid, meta *files.FileMeta) error {
+	if meta.IsExpired() {
+		return errors.Errorf("file %s has expired", fileCid.String())
+	}
+	providerCid, err := files.ProviderCid(fileCid, meta)
 	if err != nil {
-		return "", err
+		return err
 	}
-	return path, nil
+	return fs.dht.StartProviding(providerCid)
 }
 
-func (fs *FileShareProtocol) downloadFile(providers []peer.AddrInfo, fileCid cid.Cid) (string, *peer.ID) {
-	// TODO maybe I have to firstly run Connect(peer)? or maybe at least put addrInfo to peer book?
-	// 	    So it does not have to be found in DHTs
-	reqMsg, err := fs.createP2PFileDownloadReq(fileCid)
+// stopProviding withdraws the file from DHT
+func (fs *FileShareProtocol) stopProviding(fileCid cid.Cid, meta *files.FileMeta) {
+	providerCid, err := files.ProviderCid(fileCid, meta)
 	if err != nil {
-		log.Errorf("error generationg file download req: %s", err)
-		return "", nil
+		log.Errorf("error deriving provider cid of file %s: %s", fileCid.String(), err)
+		return
 	}
+	fs.dht.StopProviding(providerCid)
+}
 
-	for _, p := range providers {
-		path, err := fs.tryFileProvider(reqMsg, p.ID, fileCid)
-		if err != nil {
-			log.Error(err)
-			continue
+// spreadMetadata spreads metadata of the file to other peers until the
+// spreading strategy ends or the file expires
+func (fs *FileShareProtocol) spreadMetadata(meta *files.FileMeta, msg *pb.FileMetadata, from peer.ID) {
+	done := make(chan struct{})
+	stop := fs.spreader.startSpreading(p2pFileShareMetadataProtocol, meta.Severity, meta.Rights, msg, from,
+		nil, func() { close(done) })
+	go func() {
+		expiry := time.NewTimer(time.Until(meta.ExpiredAt))
+		defer expiry.Stop()
+		select {
+		case <-expiry.C:
+			stop()
+		case <-done:
 		}
-		return path, &p.ID
-	}
-	return "", nil
+	}()
 }
 
-func (fs *FileShareProtocol) notifyTLAboutDownload(cid cid.Cid, sender peer.ID, path string) error {
+// notifyTLAboutDownload tells TL where the file is downloaded. Senders are
+// sorted by number of provided chunks, the first one is reported as the sender
+func (fs *FileShareProtocol) notifyTLAboutDownload(cid cid.Cid, senders []peer.ID, path string) error {
 	msg := Nl2TlRedisFileShareDownloadDone{
-		FileId: cid.String(),
-		Path:   path,
-		Sender: fs.MetadataOfPeer(sender),
+		FileId:  cid.String(),
+		Path:    path,
+		Senders: make([]utils.PeerMetadata, 0, len(senders)),
+	}
+	// all chunks might have been found locally
+	if len(senders) > 0 {
+		msg.Sender = fs.MetadataOfPeer(senders[0])
+	}
+	for _, sender := range senders {
+		msg.Senders = append(msg.Senders, fs.MetadataOfPeer(sender))
 	}
 	channel := "nl2tl_file_share_downloaded"
 	return fs.RedisClient.PublishMessage(channel, msg)
@@ -252,7 +361,7 @@ func (fs *FileShareProtocol) onP2PDownload(s network.Stream) {
 		log.Errorf("error decoding cid: %s", err)
 		return
 	}
-	meta := fs.fileBook.Get(&fileCid)
+	meta := fs.fileBook.Snapshot(&fileCid)
 	if meta == nil {
 		log.Errorf("unknown cid %s", req.Cid)
 		return
@@ -261,50 +370,177 @@ func (fs *FileShareProtocol) onP2PDownload(s network.Stream) {
 		log.Errorf("file with cid %s is not available", req.Cid)
 		return
 	}
+	if meta.IsExpired() {
+		log.Errorf("file with cid %s has expired", req.Cid)
+		return
+	}
 	// check rights
 	if len(meta.Rights) != 0 && !fs.OrgBook.HasPeerRight(remote, meta.Rights) {
 		log.Errorf("peer %s has no right for %s", remote.String(), req.Cid)
 		return
 	}
 	log.Debugf("peer is authorized to download the file")
+	fs.fileBook.Touch(&fileCid)
 
-	resp, err := fs.createFileDownloadResp("OK", meta.Path)
+	err = fs.sendFile(s, fileCid, meta, req)
 	if err != nil {
-		log.Errorf("error creating file download resp: %s", err)
+		log.Errorf("error sending file %s: %s", req.Cid, err)
 		return
 	}
-	err = fs.WriteProtoMsg(resp, s)
+	log.Infof("successfully finished p2p file download request")
+}
+
+// sendFile streams requested chunks of the file preceded by its manifest, so
+// neither side has to hold the whole file in memory. If no chunks are
+// requested, the whole file is sent unless only the manifest is requested.
+// Chunks are compressed with the first compression accepted by both sides.
+// Meta is a snapshot of the metadata, changes are stored through the file book
+func (fs *FileShareProtocol) sendFile(s network.Stream, fileCid cid.Cid, meta *files.FileMeta, req *pb.FileDownloadRequest) error {
+	chunks := req.Chunks
+	if err := fs.checkChunkSize(meta.ChunkSize); err != nil {
+		return err
+	}
+	if meta.ChunkHashes == nil {
+		return errors.New("hashes of file chunks are not known")
+	}
+	if req.WeakHashes && meta.WeakHashes == nil {
+		weak, err := files.WeakChunkHashes(meta.Path, meta.ChunkSize)
+		if err != nil {
+			return errors.WithMessage(err, "error computing weak hashes of file chunks: ")
+		}
+		meta.WeakHashes = weak
+		fs.fileBook.SetWeakHashes(&fileCid, weak)
+	}
+	for _, index := range chunks {
+		if int(index) >= len(meta.ChunkHashes) {
+			return errors.Errorf("requested chunk %d out of %d chunks", index, len(meta.ChunkHashes))
+		}
+	}
+	compression := fs.selectCompression(req.Compressions)
+	manifest, err := fs.createFileManifest("OK", meta, compression, req.WeakHashes)
 	if err != nil {
-		log.Errorf("error sending file share response: %s", err)
-		return
+		return errors.WithMessage(err, "error creating file manifest: ")
 	}
-	log.Infof("successfully finished p2p file download request")
+	w := bufio.NewWriter(s)
+	if err = fs.WriteDelimitedProtoMsg(manifest, w); err != nil {
+		return err
+	}
+	if req.OnlyManifest {
+		return w.Flush()
+	}
+	if len(chunks) == 0 {
+		chunks = make([]uint32, len(meta.ChunkHashes))
+		for i := range chunks {
+			chunks[i] = uint32(i)
+		}
+	}
+
+	f, err := os.Open(meta.Path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	buf := make([]byte, meta.ChunkSize)
+	for _, index := range chunks {
+		n, err := f.ReadAt(buf, int64(index)*meta.ChunkSize)
+		if err != nil && err != io.EOF {
+			return errors.WithMessage(err, "error reading file chunk: ")
+		}
+		err = fs.WriteDelimitedProtoMsg(compressChunk(index, buf[:n], compression), w)
+		if err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// selectCompression returns the first compression accepted by the requester
+// which is enabled in my config, or empty string
+func (fs *FileShareProtocol) selectCompression(accepted []string) string {
+	for _, a := range accepted {
+		for _, c := range fs.compressions {
+			if a == c {
+				return c
+			}
+		}
+	}
+	return ""
+}
+
+// compressChunk creates chunk message with compressed data. Data which do not
+// get smaller (e.g. already compressed files) are sent uncompressed
+func compressChunk(index uint32, data []byte, compression string) *pb.FileChunk {
+	if compression != "" {
+		compressed, err := files.Compress(compression, data)
+		if err == nil && len(compressed) < len(data) {
+			return &pb.FileChunk{Index: index, Data: compressed, Compressed: true}
+		}
+	}
+	return &pb.FileChunk{Index: index, Data: data}
 }
 
-func (fs *FileShareProtocol) createFileDownloadResp(status string, path string) (*pb.FileDownloadResponse, error) {
+func (fs *FileShareProtocol) createFileManifest(status string, meta *files.FileMeta, compression string,
+	weakHashes bool) (*pb.FileManifest, error) {
 	msgMetaData, err := fs.NewProtoMetaData()
 	if err != nil {
 		return nil, errors.WithMessage(err, "error generating new proto metadata: ")
 	}
-	data := make([]byte, 0)
-	if path != "" {
-		data, err = os.ReadFile(path)
-		if err != nil {
-			return nil, err
+	manifest := &pb.FileManifest{
+		Metadata:    msgMetaData,
+		Status:      status,
+		Size:        meta.Size,
+		ChunkSize:   meta.ChunkSize,
+		ChunkHashes: meta.ChunkHashes,
+		Compression: compression,
+	}
+	if weakHashes {
+		manifest.WeakHashes = meta.WeakHashes
+	}
+
+	signature, err := fs.SignProtoMessage(manifest)
+	if err != nil {
+		return nil, errors.WithMessage(err, "error generating signature for new file manifest: ")
+	}
+	manifest.Metadata.Signature = signature
+	return manifest, nil
+}
+
+// OnFileExpired stops sharing of the expired file and tells TL about it.
+// Downloaded copy of the file is deleted if it is enabled in config, otherwise
+// it stays in the book as expired until it is evicted
+func (fs *FileShareProtocol) OnFileExpired(fileCid cid.Cid, meta *files.FileMeta) {
+	// provider records already published in other peers expire, requests
+	// for the file are refused meanwhile
+	fs.stopProviding(fileCid, meta)
+	deleted := false
+	if fs.deleteExpiredFiles && meta.Downloaded && meta.Path != "" {
+		err := os.Remove(meta.Path)
+		if err != nil && !os.IsNotExist(err) {
+			log.Errorf("error deleting expired file %s: %s", meta.Path, err)
+		} else {
+			deleted = true
 		}
 	}
-	resp := &pb.FileDownloadResponse{
-		Metadata: msgMetaData,
-		Status:   status,
-		Data:     data,
+	if fs.deleteExpiredFiles {
+		// remove also partial downloads of the file
+		_ = os.Remove(fs.filePath(fileCid) + partSuffix)
+	}
+	if deleted {
+		fs.fileBook.Remove(&fileCid)
 	}
+	fs.forgetDownloadJob(fileCid)
 
-	signature, err := fs.SignProtoMessage(resp)
+	msg := Nl2TlRedisFileShareExpired{
+		FileId:  fileCid.String(),
+		Path:    meta.Path,
+		Deleted: deleted,
+	}
+	err := fs.RedisClient.PublishMessage("nl2tl_file_share_expired", msg)
 	if err != nil {
-		return nil, errors.WithMessage(err, "error generating signature for new file share resp: ")
+		log.Errorf("error sending file expiration to redis: %s", err)
 	}
-	resp.Metadata.Signature = signature
-	return resp, nil
 }
 
 func (fs *FileShareProtocol) onP2PMetadata(s network.Stream) {
@@ -338,15 +574,13 @@ func (fs *FileShareProtocol) onP2PMetadata(s network.Stream) {
 		log.Errorf("error creating metadata from p2p msg: %s", err)
 		return
 	}
-	fileCid, err := cid.Decode(p2pMeta.Cid)
-	if err != nil {
-		log.Errorf("error decoding cid: %s", err)
+	if meta.IsExpired() {
+		log.Debugf("received metadata of file %s which has already expired", p2pMeta.Cid)
 		return
 	}
-
-	err = fs.fileBook.AddFile(&fileCid, meta)
+	fileCid, err := cid.Decode(p2pMeta.Cid)
 	if err != nil {
-		log.Error(err)
+		log.Errorf("error decoding cid: %s", err)
 		return
 	}
 	sender, err := peer.Decode(p2pMeta.Metadata.OriginalSender.NodeId)
@@ -354,13 +588,41 @@ func (fs *FileShareProtocol) onP2PMetadata(s network.Stream) {
 		log.Errorf("error decoding original sender peer id: %s", err)
 		return
 	}
+	if meta.Feed != "" {
+		err = fs.checkFeedVersion(meta, sender)
+		if err != nil {
+			log.Errorf("refusing file metadata: %s", err)
+			return
+		}
+	}
 
-	err = fs.notifyTLAboutMetadata(fileCid, sender, meta)
-	if err != nil {
-		log.Errorf("error sending to Redis metadata info: %s", err)
+	// metadata not matching subscriptions of TL are only indexed or dropped,
+	// but they are spread further anyway as other peers may be interested
+	subscribed := fs.isSubscribed(sender, meta)
+	if !subscribed && fs.dropNonMatchingMeta {
+		log.Debugf("dropping metadata of file %s not matching any subscription of TL", fileCid.String())
+	} else {
+		err = fs.fileBook.AddFile(&fileCid, meta)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+
+		updated := meta.Feed != "" && fs.updateFeed(fileCid, meta)
+		switch {
+		case !subscribed:
+			log.Debugf("indexed metadata of file %s not matching any subscription of TL", fileCid.String())
+		case updated:
+			err = fs.notifyTLAboutUpdate(fileCid, sender, meta)
+		default:
+			err = fs.notifyTLAboutMetadata(fileCid, sender, meta)
+		}
+		if err != nil {
+			log.Errorf("error sending to Redis metadata info: %s", err)
+		}
 	}
 
-	fs.spreader.startSpreading(p2pFileShareMetadataProtocol, meta.Severity, meta.Rights, p2pMeta, s.Conn().RemotePeer())
+	fs.spreadMetadata(meta, p2pMeta, s.Conn().RemotePeer())
 	log.Infof("handler onP2PMetadata finished")
 }
 
@@ -389,39 +651,62 @@ func (fs *FileShareProtocol) onRedisFileAnnouncement(data []byte) {
 		log.Errorf("error validating the data: %s", err)
 		return
 	}
+	if meta.IsExpired() {
+		log.Errorf("announced file %s has already expired at %s", fileCid.String(), meta.ExpiredAt)
+		return
+	}
+	if fileAnnouncement.Feed != "" {
+		err = fs.setNextFeedVersion(*fileCid, meta, fileAnnouncement.Feed)
+		if err != nil {
+			log.Error(err)
+			return
+		}
+	}
 	err = fs.fileBook.AddFile(fileCid, meta)
 	if err != nil {
 		log.Error(err)
 		return
 	}
+	if meta.Feed != "" {
+		fs.updateFeed(*fileCid, meta)
+		log.Infof("file %s is version %d of feed %s", fileCid.String(), meta.Version, meta.Feed)
+	}
 
-	err = fs.dht.StartProviding(*fileCid)
+	err = fs.startProviding(*fileCid, meta)
 	if err != nil {
 		log.Errorf("error starting providing file in dht: %s", err)
 		return
 	}
 	log.Debugf("successfully started providing file %s", fileCid.String())
 
-	protoMsg, err := fs.createP2PMeta(*fileCid, fileAnnouncement)
+	protoMsg, err := fs.createP2PMeta(*fileCid, fileAnnouncement, meta)
 	if err != nil {
 		log.Errorf("error creating p2p proto metadata: %s", err)
 		return
 	}
 
+	if meta.Feed != "" {
+		err = fs.publishFeedHead(fileAnnouncement.Feed, protoMsg, meta)
+		if err != nil {
+			log.Errorf("error publishing version %d of feed %s: %s", meta.Version, meta.Feed, err)
+			return
+		}
+	}
+
 	// store this msg as seen in case it comes back from another peer
 	fs.NewMsgSeen(protoMsg.Metadata.Id, fs.Host.ID())
 
-	fs.spreader.startSpreading(p2pFileShareMetadataProtocol, meta.Severity, meta.Rights, protoMsg, fs.Host.ID())
+	fs.spreadMetadata(meta, protoMsg, fs.Host.ID())
 	log.Debugf("handling file share annoucment from TL ended")
 }
 
-func (fs *FileShareProtocol) createP2PMeta(fCid cid.Cid, meta Tl2NlRedisFileShareAnnounce) (*pb.FileMetadata, error) {
+func (fs *FileShareProtocol) createP2PMeta(fCid cid.Cid, ann Tl2NlRedisFileShareAnnounce, meta *files.FileMeta) (*pb.FileMetadata, error) {
 	msgMetaData, err := fs.NewProtoMetaData()
 	if err != nil {
 		return nil, errors.WithMessage(err, "error generating new proto metadata: ")
 	}
 
-	bytesDesc, err := json.Marshal(meta.Description)
+	bytesDesc, err := json.Marshal(ann.Description)
 	if err != nil {
 		return nil, err
 	}
@@ -430,9 +715,18 @@ func (fs *FileShareProtocol) createP2PMeta(fCid cid.Cid, meta Tl2NlRedisFileShar
 		Metadata:    msgMetaData,
 		Cid:         fCid.String(),
 		Description: bytesDesc,
-		Rights:      meta.Rights,
-		Severity:    meta.Severity,
-		ExpiredAt:   meta.ExpiredAt,
+		Rights:      ann.Rights,
+		Severity:    ann.Severity,
+		ExpiredAt:   ann.ExpiredAt,
+		Size:        meta.Size,
+		ChunkSize:   meta.ChunkSize,
+		ChunksRoot:  meta.ChunksRoot,
+		ProviderKey: meta.ProviderKey,
+		Feed:        meta.Feed,
+		Version:     meta.Version,
+	}
+	if meta.PreviousCid.Defined() {
+		protoMsg.PreviousCid = meta.PreviousCid.String()
 	}
 	signature, err := fs.SignProtoMessage(protoMsg)
 	if err != nil {
@@ -459,6 +753,15 @@ func (fs *FileShareProtocol) fileMetaFromP2P(p2pMeta *pb.FileMetadata) (*files.F
 		rights = append(rights, o)
 	}
 
+	// chunking is checked before it is used to allocate buffers or to
+	// compute number of chunks
+	if err = fs.checkChunking(p2pMeta.Size, p2pMeta.ChunkSize); err != nil {
+		return nil, err
+	}
+	if len(p2pMeta.ChunksRoot) == 0 {
+		return nil, errors.New("missing chunks root")
+	}
+
 	var desc interface{}
 	err = json.Unmarshal(p2pMeta.Description, &desc)
 	if err != nil {
@@ -473,6 +776,18 @@ func (fs *FileShareProtocol) fileMetaFromP2P(p2pMeta *pb.FileMetadata) (*files.F
 		Rights:      rights,
 		Severity:    severity,
 		Description: desc,
+		Size:        p2pMeta.Size,
+		ChunkSize:   p2pMeta.ChunkSize,
+		ChunksRoot:  p2pMeta.ChunksRoot,
+		ProviderKey: p2pMeta.ProviderKey,
+		Feed:        p2pMeta.Feed,
+		Version:     p2pMeta.Version,
+	}
+	if p2pMeta.PreviousCid != "" {
+		meta.PreviousCid, err = cid.Decode(p2pMeta.PreviousCid)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return meta, nil
 
@@ -499,6 +814,25 @@ func (fs *FileShareProtocol) fileMetaFromRedis(ann *Tl2NlRedisFileShareAnnounce)
 		rights = append(rights, o)
 	}
 
+	size, chunkHashes, err := files.ChunkHashes(ann.Path, fs.chunkSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	// other peers would refuse the file
+	if err = fs.checkChunking(size, fs.chunkSize); err != nil {
+		return nil, nil, err
+	}
+
+	// providers of files with rights are announced under secret key, which
+	// is spread only to authorized peers together with the metadata
+	var providerKey []byte
+	if len(rights) > 0 {
+		providerKey = make([]byte, providerKeySize)
+		if _, err = rand.Read(providerKey); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	meta := &files.FileMeta{
 		ExpiredAt:   expiredAt,
 		Expired:     time.Now().After(expiredAt),
@@ -507,6 +841,11 @@ func (fs *FileShareProtocol) fileMetaFromRedis(ann *Tl2NlRedisFileShareAnnounce)
 		Rights:      rights,
 		Severity:    severity,
 		Description: ann.Description,
+		Size:        size,
+		ChunkSize:   fs.chunkSize,
+		ChunksRoot:  files.ChunksRoot(chunkHashes),
+		ChunkHashes: chunkHashes,
+		ProviderKey: providerKey,
 	}
 	return fileCid, meta, nil
 }
@@ -0,0 +1,129 @@
+package protocols
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/pkg/errors"
+
+	"happystoic/p2pnetwork/pkg/files"
+	"happystoic/p2pnetwork/pkg/org"
+)
+
+type Tl2NlRedisFileShareSubscribe struct {
+	Id          string                 `json:"id"`
+	MinSeverity string                 `json:"min_severity"`
+	Orgs        []string               `json:"orgs"`
+	Description map[string]interface{} `json:"description"`
+}
+
+type Tl2NlRedisFileShareUnsubscribe struct {
+	Id string `json:"id"`
+}
+
+// fileSubscription is filter of file metadata TL wants to be notified about.
+// Empty parts of the filter match all metadata
+type fileSubscription struct {
+	minSeverity files.Severity
+	orgs        []*org.Org
+	description map[string]interface{}
+}
+
+func (fs *FileShareProtocol) newFileSubscription(sub *Tl2NlRedisFileShareSubscribe) (*fileSubscription, error) {
+	fileSub := &fileSubscription{description: sub.Description}
+	if sub.MinSeverity != "" {
+		severity, err := files.SeverityFromString(sub.MinSeverity)
+		if err != nil {
+			return nil, err
+		}
+		fileSub.minSeverity = severity
+	}
+	orgs, err := org.DecodeAll(sub.Orgs)
+	if err != nil {
+		return nil, errors.WithMessage(err, "error decoding orgs of subscription: ")
+	}
+	fileSub.orgs = orgs
+	return fileSub, nil
+}
+
+// matches returns true if the metadata authored by author match the filter
+func (s *fileSubscription) matches(author peer.ID, meta *files.FileMeta, orgBook *org.Book) bool {
+	if meta.Severity < s.minSeverity {
+		return false
+	}
+	if len(s.orgs) > 0 && !orgBook.HasPeerRight(author, s.orgs) {
+		return false
+	}
+	if len(s.description) == 0 {
+		return true
+	}
+	desc, ok := meta.Description.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for key, value := range s.description {
+		if !reflect.DeepEqual(desc[key], value) {
+			return false
+		}
+	}
+	return true
+}
+
+// isSubscribed returns true if metadata match at least one subscription of
+// TL. Without any subscription, TL is notified about all metadata
+func (fs *FileShareProtocol) isSubscribed(author peer.ID, meta *files.FileMeta) bool {
+	fs.subsLock.Lock()
+	defer fs.subsLock.Unlock()
+
+	if len(fs.subscriptions) == 0 {
+		return true
+	}
+	for _, sub := range fs.subscriptions {
+		if sub.matches(author, meta, fs.OrgBook) {
+			return true
+		}
+	}
+	return false
+}
+
+func (fs *FileShareProtocol) onSubscribe(data []byte) {
+	sub := Tl2NlRedisFileShareSubscribe{}
+	err := json.Unmarshal(data, &sub)
+	if err != nil {
+		log.Errorf("error unmarshalling Tl2NlRedisFileShareSubscribe from redis: %s", err)
+		return
+	}
+	if sub.Id == "" {
+		log.Errorf("file share subscription has no id")
+		return
+	}
+	fileSub, err := fs.newFileSubscription(&sub)
+	if err != nil {
+		log.Errorf("error creating file share subscription %s: %s", sub.Id, err)
+		return
+	}
+
+	fs.subsLock.Lock()
+	defer fs.subsLock.Unlock()
+	fs.subscriptions[sub.Id] = fileSub
+	log.Infof("TL subscribed to file metadata with subscription %s", sub.Id)
+}
+
+func (fs *FileShareProtocol) onUnsubscribe(data []byte) {
+	unsub := Tl2NlRedisFileShareUnsubscribe{}
+	err := json.Unmarshal(data, &unsub)
+	if err != nil {
+		log.Errorf("error unmarshalling Tl2NlRedisFileShareUnsubscribe from redis: %s", err)
+		return
+	}
+
+	fs.subsLock.Lock()
+	defer fs.subsLock.Unlock()
+	if _, exists := fs.subscriptions[unsub.Id]; !exists {
+		log.Errorf("unknown file share subscription %s", unsub.Id)
+		return
+	}
+	delete(fs.subscriptions, unsub.Id)
+	log.Infof("TL unsubscribed file metadata subscription %s", unsub.Id)
+}
@@ -3,37 +3,60 @@ package protocols
 import (
 	"context"
 	"encoding/json"
+	"sync"
 	"time"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/ipfs/go-cid"
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
 	"github.com/pkg/errors"
 
 	"happystoic/p2pnetwork/pkg/config"
 	"happystoic/p2pnetwork/pkg/messaging/pb"
 	"happystoic/p2pnetwork/pkg/messaging/utils"
+	"happystoic/p2pnetwork/pkg/org"
 )
 
 // p2p protocol definition
 const p2pIntelRequestProtocol = "/intelligence-request/0.0.1"
 const p2pIntelResponseProtocol = "/intelligence-response/0.0.1"
-
-const numberOfRecipients = 3 // todo maybe make this configurable in yaml?
+const p2pIntelCancelProtocol = "/intelligence-cancel/0.0.1"
 
 type RedisTl2NlIntelRequest struct {
+	// RequestId is optional. If set, it is used as ID of the request, so TL
+	// can cancel the request later
+	RequestId string `json:"request_id"`
+	// Rights is optional list of organisations. If set, request is sent only
+	// to peers with verified signature of at least one of them
+	Rights []string `json:"rights"`
+	// CacheKey is optional. If set, responders may answer the request from
+	// their cache of previous responses with the same key
+	CacheKey string `json:"cache_key"`
+	// Topic is optional. If set, request is routed to peers advertising
+	// expertise in the topic
+	Topic   string      `json:"topic"`
 	Payload interface{} `json:"payload"`
 }
 
+type RedisTl2NlIntelCancel struct {
+	RequestId string `json:"request_id"`
+}
+
 type RedisNl2TlIntelRequest struct {
 	RequestId string             `json:"request_id"`
 	Sender    utils.PeerMetadata `json:"sender"`
+	CacheKey  string             `json:"cache_key"`
 	Payload   interface{}        `json:"payload"`
 }
 
 type RedisTl2NlIntelResponse struct {
-	RequestId string      `json:"request_id"`
-	Payload   interface{} `json:"payload"`
+	RequestId string `json:"request_id"`
+	// CacheTtl is number of seconds for how long the response can be used to
+	// answer requests with the same cache key. Zero means no caching
+	CacheTtl int         `json:"cache_ttl"`
+	Payload  interface{} `json:"payload"`
 }
 
 type RedisNl2TlIntelligenceResponse []*IntelligenceResponse
@@ -42,6 +65,35 @@ type IntelligenceResponse struct {
 	Payload interface{}        `json:"payload"`
 }
 
+type RedisNl2TlIntelResponsePartial struct {
+	RequestId string `json:"request_id"`
+	*IntelligenceResponse
+}
+
+type RedisNl2TlIntelResponseComplete struct {
+	RequestId string `json:"request_id"`
+	Expected  int    `json:"expected"`  // number of peers the request was sent to
+	Received  int    `json:"received"`  // number of peers who responded
+	Delivered int    `json:"delivered"` // number of responses delivered to TL
+	Rejected  int    `json:"rejected"`  // number of responses which failed verification
+	TimedOut  bool   `json:"timed_out"`
+}
+
+// forwardedRequest holds who asked me and who I asked about the request, so
+// its cancellation can follow the forwarding tree
+type forwardedRequest struct {
+	requester peer.ID
+	children  []peer.ID
+	cancelled bool
+}
+
+// streamStats holds statistics of request whose responses are streamed to TL
+type streamStats struct {
+	expected  int
+	delivered int
+	rejected  int
+}
+
 // IntelligenceProtocol type
 type IntelligenceProtocol struct {
 	*utils.ProtoUtils
@@ -49,7 +101,24 @@ type IntelligenceProtocol struct {
 	ctx                  context.Context
 	respStorage          *utils.ResponseAggregator
 	settings             *config.IntelligenceSettings
+	fanout               *FanoutController
 	cacheRequestToSender map[string]peer.ID
+
+	// rights of org-scoped requests that are being processed
+	rightsLock    sync.Mutex
+	requestRights map[string][]*org.Org
+
+	// my requests whose responses are streamed to TL
+	streamLock sync.Mutex
+	streamed   map[string]*streamStats
+
+	forwardLock sync.Mutex
+	forwarded   map[string]*forwardedRequest
+
+	// cache of TL's responses and cache keys of requests TL is answering
+	respCache     *utils.TtlCache
+	cacheKeysLock sync.Mutex
+	cacheKeys     map[string]string
 }
 
 func NewIntelligenceProtocol(ctx context.Context,
@@ -59,17 +128,33 @@ func NewIntelligenceProtocol(ctx context.Context,
 		ProtoUtils:           pu,
 		ctx:                  ctx,
 		settings:             c,
+		fanout:               NewFanoutController(c),
 		cacheRequestToSender: make(map[string]peer.ID),
+		requestRights:        make(map[string][]*org.Org),
+		streamed:             make(map[string]*streamStats),
+		forwarded:            make(map[string]*forwardedRequest),
+		cacheKeys:            make(map[string]string),
+	}
+	if c.ResponseCache {
+		ip.respCache = utils.NewTtlCache(c.ResponseCacheSize)
 	}
 	ip.respStorage = utils.NewResponseAggregator(ip.onAggregatedP2PResponses)
+	ip.respStorage.SetResponseHandler(ip.onStoredP2PResponse)
 	//
 	_ = ip.RedisClient.SubscribeCallback("tl2nl_intelligence_request", ip.onRedisIntelligenceRequest)
 	_ = ip.RedisClient.SubscribeCallback("tl2nl_intelligence_response", ip.onRedisIntelligenceResponse)
+	_ = ip.RedisClient.SubscribeCallback("tl2nl_intelligence_cancel", ip.onRedisIntelligenceCancel)
 	ip.Host.SetStreamHandler(p2pIntelRequestProtocol, ip.onP2PRequest)
 	ip.Host.SetStreamHandler(p2pIntelResponseProtocol, ip.onP2PResponse)
+	ip.Host.SetStreamHandler(p2pIntelCancelProtocol, ip.onP2PCancel)
 	return ip
 }
 
+// PeerDisconnected stops waiting for intelligence responses of disconnected peer
+func (ip *IntelligenceProtocol) PeerDisconnected(p peer.ID) {
+	ip.respStorage.PeerDisconnected(p)
+}
+
 // ###################################################
 // ### TL sends through Redis Intelligence request ###
 // ###################################################
@@ -85,24 +170,39 @@ func (ip *IntelligenceProtocol) onRedisIntelligenceRequest(data []byte) {
 }
 
 func (ip *IntelligenceProtocol) initiateP2PIntelligenceRequest(req *RedisTl2NlIntelRequest) {
-	p2pRequest, err := ip.createP2PIntelRequest(req.Payload)
+	rights, err := org.DecodeAll(req.Rights)
+	if err != nil {
+		log.Errorf("error decoding rights of intelligence request: %s", err)
+		return
+	}
+	p2pRequest, err := ip.createP2PIntelRequest(req)
 	if err != nil {
 		log.Errorf("error creating p2p intelligence request: %s", err)
 		return
 	}
 	ip.SeenMessagesCache.NewMsgSeen(p2pRequest.IntelligenceRequest.Metadata.Id, ip.Host.ID())
+	ip.setRequestRights(p2pRequest.IntelligenceRequest.Metadata.Id, rights)
 
-	pids, err := ip.GetNPeersExpProbAllAllow(ip.ConnectedPeers(), numberOfRecipients)
+	pids, err := ip.selectRecipients(p2pRequest, ip.fanout.Fanout(0), rights, make(map[peer.ID]struct{}))
 	if err != nil {
-		log.Errorf("error getting n peers from connected peers %s", err)
+		log.Errorf("error selecting recipients of intelligence request: %s", err)
 		return
 	}
+	for _, pid := range pids {
+		p2pRequest.SeenBy = append(p2pRequest.SeenBy, pid.String())
+	}
 
 	// start waiter, who will process all responses when they are aggregated or timeout elapses
 	reqId := p2pRequest.IntelligenceRequest.Metadata.Id
-	err = ip.respStorage.StartWaiting(ip.ctx, reqId, nil, len(pids), ip.settings.RootTimeout)
+	if ip.settings.StreamPartialResults {
+		ip.startStreaming(reqId, len(pids))
+	}
+	ip.trackRequest(reqId, ip.Host.ID(), pids)
+	err = ip.respStorage.StartWaiting(ip.ctx, reqId, nil, pids, ip.settings.RootTimeout)
 	if err != nil {
 		log.Errorf("error when starting to wait for intelligence responses: %s", err)
+		ip.stopStreaming(reqId)
+		ip.untrackRequest(reqId)
 		return
 	}
 
@@ -112,13 +212,15 @@ func (ip *IntelligenceProtocol) initiateP2PIntelligenceRequest(req *RedisTl2NlIn
 		err = ip.SendProtoMessage(pid, p2pIntelRequestProtocol, p2pRequest)
 		if err != nil {
 			log.Errorf("error sending intelligence request to node %s: %s", pid, err)
+			// do not wait for response that will never come
+			_ = ip.respStorage.RemoveResponder(reqId, pid)
 			continue
 		}
 	}
 }
 
-func (ip *IntelligenceProtocol) createP2PIntelRequest(payload interface{}) (*pb.IntelligenceReqEnvelope, error) {
-	payloadBytes, err := json.Marshal(payload)
+func (ip *IntelligenceProtocol) createP2PIntelRequest(req *RedisTl2NlIntelRequest) (*pb.IntelligenceReqEnvelope, error) {
+	payloadBytes, err := json.Marshal(req.Payload)
 	if err != nil {
 		return nil, err
 	}
@@ -126,10 +228,19 @@ func (ip *IntelligenceProtocol) createP2PIntelRequest(payload interface{}) (*pb.
 	if err != nil {
 		return nil, errors.WithMessage(err, "error generating new proto metadata: ")
 	}
+	if req.RequestId != "" {
+		if ip.WasMsgSeen(req.RequestId) {
+			return nil, errors.Errorf("intelligence request with id %s already exists", req.RequestId)
+		}
+		msgMetaData.Id = req.RequestId
+	}
 
 	protoMsg := &pb.IntelligenceRequest{
 		Metadata: msgMetaData,
 		Payload:  payloadBytes,
+		Rights:   req.Rights,
+		CacheKey: req.CacheKey,
+		Topic:    req.Topic,
 	}
 	signature, err := ip.SignProtoMessage(protoMsg)
 	if err != nil {
@@ -139,7 +250,7 @@ func (ip *IntelligenceProtocol) createP2PIntelRequest(payload interface{}) (*pb.
 
 	envelope := &pb.IntelligenceReqEnvelope{
 		Ttl:                 ip.settings.Ttl,
-		ParentTimeout:       ip.settings.RootTimeout.String(),
+		Deadline:            time.Now().Add(ip.settings.RootTimeout).UnixMilli(),
 		IntelligenceRequest: protoMsg,
 	}
 	return envelope, nil
@@ -157,7 +268,20 @@ func (ip *IntelligenceProtocol) createP2PIntelRequest(payload interface{}) (*pb.
 //
 func (ip *IntelligenceProtocol) onAggregatedP2PResponses(requestId string, responses []proto.Message, meta *utils.StorageMetadata) {
 	log.Debugf("all intelligence responses were aggregated, starting to collect them")
+	defer ip.deleteRequestRights(requestId)
+	defer ip.takeCacheKey(requestId)
+	cancelled := ip.untrackRequest(requestId)
+
+	// I am the original requester and responses were already streamed to TL
+	if stats := ip.stopStreaming(requestId); stats != nil {
+		err := ip.sendIntelligenceCompletionToRedis(requestId, stats, len(responses))
+		if err != nil {
+			log.Errorf("error sending intelligence completion to TL through Redis: %s", err)
+		}
+		return
+	}
 
+	processedResponses := make([]*pb.IntelligenceResponse, 0, len(responses))
 	listOfSingleResponses := make([][]byte, 0, len(responses))
 	for i := range responses {
 		resp := pb.IntelligenceResponse{}
@@ -169,7 +293,11 @@ func (ip *IntelligenceProtocol) onAggregatedP2PResponses(requestId string, respo
 			continue
 		}
 
-		listOfSingleResponses = append(listOfSingleResponses, resp.Responses...)
+		// relay only authentic responses, so I am not blamed for forgeries of others
+		_, authentic := ip.authenticSingleResponses(requestId, &resp)
+		resp.Responses = authentic
+		processedResponses = append(processedResponses, &resp)
+		listOfSingleResponses = append(listOfSingleResponses, authentic...)
 	}
 
 	if len(listOfSingleResponses) == 0 {
@@ -179,6 +307,10 @@ func (ip *IntelligenceProtocol) onAggregatedP2PResponses(requestId string, respo
 
 	// I should send collected responses back to the sender
 	if meta != nil && meta.ResponsesReceiver != ip.Host.ID() {
+		if cancelled {
+			log.Debugf("intelligence request %s was cancelled, not sending responses to the sender", requestId)
+			return
+		}
 		resp, err := ip.createP2PIntelligenceResponse(requestId, listOfSingleResponses)
 		if err != nil {
 			log.Errorf("error creating p2p intelligence response: %s", err)
@@ -192,7 +324,7 @@ func (ip *IntelligenceProtocol) onAggregatedP2PResponses(requestId string, respo
 
 		// I am actually the one who initiated the request, I need to send response back to my TL through Redis
 	} else {
-		err := ip.sendIntelligenceResponseToRedis(listOfSingleResponses)
+		err := ip.sendIntelligenceResponseToRedis(requestId, processedResponses)
 		if err != nil {
 			log.Errorf("error sending intelligence response to TL through Redis: %s", err)
 			return
@@ -201,32 +333,70 @@ func (ip *IntelligenceProtocol) onAggregatedP2PResponses(requestId string, respo
 	log.Debugf("successfully ended onAggregatedP2PResponses")
 }
 
-func (ip *IntelligenceProtocol) sendIntelligenceResponseToRedis(responses [][]byte) error {
+func (ip *IntelligenceProtocol) sendIntelligenceResponseToRedis(requestId string, responses []*pb.IntelligenceResponse) error {
 	log.Debugf("sending intelligence data back to TL through redis")
 
-	//responses might need to be decrypted
 	recomRedisResp := make(RedisNl2TlIntelligenceResponse, 0, len(responses))
-	for i := range responses {
+	for _, resp := range responses {
+		verified, _ := ip.verifySingleResponses(requestId, resp)
+		recomRedisResp = append(recomRedisResp, verified...)
+	}
+	err := ip.RedisClient.PublishMessage("nl2tl_intelligence_response", recomRedisResp)
+	if err != nil {
+		return errors.WithMessage(err, "error publishing intelligence response to TL: ")
+	}
+	return nil
+}
+
+// authenticSingleResponses returns single responses relayed in resp that are
+// signed by their authors and belong to the request. Peer who relayed forged
+// responses is reported
+func (ip *IntelligenceProtocol) authenticSingleResponses(requestId string, resp *pb.IntelligenceResponse) ([]*pb.SingleEntityResponse, [][]byte) {
+	singleResponses := make([]*pb.SingleEntityResponse, 0, len(resp.Responses))
+	rawResponses := make([][]byte, 0, len(resp.Responses))
+	for _, raw := range resp.Responses {
 		//TODO decrypt the messages here first (so far it's only marshalled)
 		// ...
 
 		// decode the response
 		singleResp := &pb.SingleEntityResponse{}
-		err := proto.Unmarshal(responses[i], singleResp)
+		err := proto.Unmarshal(raw, singleResp)
 		if err != nil {
 			log.Errorf("error unmarshalling singleEntityResponse: %s", err)
 			continue
 		}
 
-		// verify signature
+		// verify signature and that the response belongs to this request
 		err = ip.AuthenticateMessage(singleResp, singleResp.Metadata)
 		if err != nil {
 			log.Errorf("error authenticating singleEntityResponse: %s", err)
 			continue
 		}
+		if singleResp.RequestId != requestId {
+			log.Errorf("singleEntityResponse for request '%s' relayed as response to request %s",
+				singleResp.RequestId, requestId)
+			continue
+		}
+		singleResponses = append(singleResponses, singleResp)
+		rawResponses = append(rawResponses, raw)
+	}
+	if forged := len(resp.Responses) - len(rawResponses); forged > 0 {
+		ip.reportRelayer(resp, forged)
+	}
+	return singleResponses, rawResponses
+}
+
+// verifySingleResponses authenticates single responses of my request relayed
+// in resp and converts them to format for TL. It returns also number of
+// rejected responses
+func (ip *IntelligenceProtocol) verifySingleResponses(requestId string, resp *pb.IntelligenceResponse) (RedisNl2TlIntelligenceResponse, int) {
+	rights := ip.rightsOfRequest(requestId)
+	singleResponses, _ := ip.authenticSingleResponses(requestId, resp)
 
+	recomRedisResp := make(RedisNl2TlIntelligenceResponse, 0, len(singleResponses))
+	for _, singleResp := range singleResponses {
 		var v interface{}
-		err = json.Unmarshal(singleResp.Payload, &v)
+		err := json.Unmarshal(singleResp.Payload, &v)
 		if err != nil {
 			log.Errorf("error unmarshalling data from one peer before sending them to TL: %s", err)
 			continue
@@ -237,18 +407,104 @@ func (ip *IntelligenceProtocol) sendIntelligenceResponseToRedis(responses [][]by
 			log.Errorf("error decoding peer ID: %s", err)
 		}
 
+		// reject responders outside the scope of org-scoped request
+		if len(rights) != 0 && !isAuthorizedResponder(senderPeerId, singleResp.Organisations, rights) {
+			log.Errorf("responder %s is not authorized to respond to org-scoped request %s", senderPeerId, requestId)
+			continue
+		}
+
 		recomRedisResp = append(recomRedisResp, &IntelligenceResponse{
 			Sender:  ip.MetadataOfPeer(senderPeerId),
 			Payload: v,
 		})
 	}
-	err := ip.RedisClient.PublishMessage("nl2tl_intelligence_response", recomRedisResp)
+	return recomRedisResp, len(resp.Responses) - len(recomRedisResp)
+}
+
+// reportRelayer reports peer who sent me intelligence response with forged
+// single responses
+func (ip *IntelligenceProtocol) reportRelayer(resp *pb.IntelligenceResponse, forged int) {
+	if resp.Metadata == nil || resp.Metadata.OriginalSender == nil {
+		return
+	}
+	relayer, err := peer.Decode(resp.Metadata.OriginalSender.NodeId)
 	if err != nil {
-		return errors.WithMessage(err, "error publishing intelligence response to TL: ")
+		log.Errorf("error decoding peer ID of intelligence response relayer: %s", err)
+		return
+	}
+	log.Errorf("peer %s relayed %d forged intelligence responses", relayer, forged)
+	err = ip.ReportPeer(relayer, "relayed forged intelligence responses")
+	if err != nil {
+		log.Errorf("error reporting peer %s: %s", relayer, err)
+	}
+}
+
+// #############################################################
+// ### Streaming responses of my requests to TL as they come ###
+// #############################################################
+func (ip *IntelligenceProtocol) onStoredP2PResponse(requestId string, msg proto.Message, _ *utils.StorageMetadata) {
+	stats := ip.streamStatsOf(requestId)
+	if stats == nil {
+		return
+	}
+	resp, ok := msg.(*pb.IntelligenceResponse)
+	if !ok || !resp.Processed {
+		return
+	}
+
+	verified, rejected := ip.verifySingleResponses(requestId, resp)
+	stats.rejected += rejected
+	for _, r := range verified {
+		err := ip.RedisClient.PublishMessage("nl2tl_intelligence_response_partial", &RedisNl2TlIntelResponsePartial{
+			RequestId:            requestId,
+			IntelligenceResponse: r,
+		})
+		if err != nil {
+			log.Errorf("error publishing partial intelligence response to TL: %s", err)
+			continue
+		}
+		stats.delivered++
+	}
+}
+
+func (ip *IntelligenceProtocol) sendIntelligenceCompletionToRedis(requestId string, stats *streamStats, received int) error {
+	completion := &RedisNl2TlIntelResponseComplete{
+		RequestId: requestId,
+		Expected:  stats.expected,
+		Received:  received,
+		Delivered: stats.delivered,
+		Rejected:  stats.rejected,
+		TimedOut:  received < stats.expected,
+	}
+	err := ip.RedisClient.PublishMessage("nl2tl_intelligence_response_complete", completion)
+	if err != nil {
+		return errors.WithMessage(err, "error publishing intelligence completion to TL: ")
 	}
 	return nil
 }
 
+func (ip *IntelligenceProtocol) startStreaming(requestId string, expected int) {
+	ip.streamLock.Lock()
+	defer ip.streamLock.Unlock()
+	ip.streamed[requestId] = &streamStats{expected: expected}
+}
+
+func (ip *IntelligenceProtocol) streamStatsOf(requestId string) *streamStats {
+	ip.streamLock.Lock()
+	defer ip.streamLock.Unlock()
+	return ip.streamed[requestId]
+}
+
+// stopStreaming stops streaming responses of the request and returns its
+// statistics or nil if the request was not streamed
+func (ip *IntelligenceProtocol) stopStreaming(requestId string) *streamStats {
+	ip.streamLock.Lock()
+	defer ip.streamLock.Unlock()
+	stats := ip.streamed[requestId]
+	delete(ip.streamed, requestId)
+	return stats
+}
+
 func (ip *IntelligenceProtocol) createP2PIntelligenceResponse(requestId string, responses [][]byte) (*pb.IntelligenceResponse, error) {
 	msgMetaData, err := ip.NewProtoMetaData()
 	if err != nil {
@@ -287,7 +543,9 @@ func (ip *IntelligenceProtocol) onP2PResponse(s network.Stream) {
 		log.Errorf("error authenticating p2P intelligence response: %s", err)
 		return
 	}
-	err = ip.respStorage.AddResponse(intelResp.RequestId, intelResp)
+	ip.fanout.RecordResponse(intelResp.Processed)
+
+	err = ip.respStorage.AddResponse(intelResp.RequestId, s.Conn().RemotePeer(), intelResp)
 	if err != nil {
 		log.Errorf("error adding intel response to respStorage with id '%s': '%s'", intelResp.RequestId, err)
 		return
@@ -306,6 +564,7 @@ func (ip *IntelligenceProtocol) onRedisIntelligenceResponse(data []byte) {
 		return
 	}
 	log.Debug("received intelligence response from TL")
+	ip.cacheResponse(&redisResponse)
 
 	fakeResp, err := ip.createFakeIntelResponse(&redisResponse)
 	if err != nil {
@@ -313,7 +572,7 @@ func (ip *IntelligenceProtocol) onRedisIntelligenceResponse(data []byte) {
 		return
 	}
 
-	err = ip.respStorage.AddResponse(fakeResp.RequestId, fakeResp)
+	err = ip.respStorage.AddResponse(fakeResp.RequestId, ip.Host.ID(), fakeResp)
 	if err != nil {
 		log.Errorf("error fake intelligence response to response storage: %s", err)
 		return
@@ -332,8 +591,10 @@ func (ip *IntelligenceProtocol) createFakeIntelResponse(redisResp *RedisTl2NlInt
 	}
 
 	protoMsg := &pb.SingleEntityResponse{
-		Metadata: msgMetaData,
-		Payload:  payloadBytes,
+		Metadata:      msgMetaData,
+		Payload:       payloadBytes,
+		Organisations: ip.authorizingOrgSigs(ip.rightsOfRequest(redisResp.RequestId)),
+		RequestId:     redisResp.RequestId,
 	}
 	signature, err := ip.SignProtoMessage(protoMsg)
 	if err != nil {
@@ -421,63 +682,161 @@ func (ip *IntelligenceProtocol) respondNoProcessing(receiver peer.ID, requestId
 }
 
 func (ip *IntelligenceProtocol) processP2PRequest(e *pb.IntelligenceReqEnvelope, sender peer.ID) error {
+	rights, err := org.DecodeAll(e.IntelligenceRequest.Rights)
+	if err != nil {
+		return errors.WithMessage(err, "error decoding rights of intelligence request: ")
+	}
+
+	// stop waiting for responses early enough, so my response reaches
+	// the parent before its deadline
+	waitUntil := ip.parentDeadline(e).Add(-ip.settings.ResponseMargin)
+	if !time.Now().Before(waitUntil) {
+		return errors.Errorf("deadline of intelligence request %s already elapsed",
+			e.IntelligenceRequest.Metadata.Id)
+	}
+
 	var v interface{}
 	if err := json.Unmarshal(e.IntelligenceRequest.Payload, &v); err != nil {
 		return err
 	}
+	ip.setRequestRights(e.IntelligenceRequest.Metadata.Id, rights)
 
 	senderPeerId, err := peer.Decode(e.IntelligenceRequest.Metadata.OriginalSender.NodeId)
 	if err != nil {
 		log.Errorf("error decoding peer ID: %s", err)
 	}
-	// send request to redis
-	requestToRedis := RedisNl2TlIntelRequest{
-		RequestId: e.IntelligenceRequest.Metadata.Id,
-		Sender:    ip.MetadataOfPeer(senderPeerId),
-		Payload:   v,
-	}
-	err = ip.RedisClient.PublishMessage("nl2tl_intelligence_request", requestToRedis)
+	// start waiter, who will process all responses when they are aggregated
+	// or timeout elapses. It must be started before the request is sent to
+	// my TL, so its response is not dropped when it comes before children
+	// are selected. Children are added to responders once they are known
+	reqId := e.IntelligenceRequest.Metadata.Id
+	ip.trackRequest(reqId, senderPeerId, nil)
+	err = ip.respStorage.StartWaitingOpen(ip.ctx, reqId, &utils.StorageMetadata{ResponsesReceiver: sender},
+		[]peer.ID{ip.Host.ID()}, time.Until(waitUntil))
 	if err != nil {
+		ip.untrackRequest(reqId)
 		return err
 	}
-	waitForResponses := 1 // for now just wait for response from redis
 
-	// update envelope (timeout and ttl) and send further into the network
-	if e.Ttl != 0 {
-		updatedMsg, err := ip.updateEnvelope(e)
+	// send request to redis, unless TL already answered the same question
+	cacheKey := e.IntelligenceRequest.CacheKey
+	cachedPayload, cached := ip.cachedResponse(cacheKey)
+	if cached {
+		log.Debugf("answering intelligence request %s from cache with key %s", reqId, cacheKey)
+		if err = ip.respondFromCache(reqId, cachedPayload); err != nil {
+			log.Error(err)
+		}
+	} else {
+		ip.setCacheKey(reqId, cacheKey)
+		requestToRedis := RedisNl2TlIntelRequest{
+			RequestId: reqId,
+			Sender:    ip.MetadataOfPeer(senderPeerId),
+			CacheKey:  cacheKey,
+			Payload:   v,
+		}
+		err = ip.RedisClient.PublishMessage("nl2tl_intelligence_request", requestToRedis)
 		if err != nil {
-			log.Errorf("error updating envelope in intelligence request: %s", err)
+			log.Errorf("error sending intelligence request to redis: %s", err)
+			_ = ip.respStorage.RemoveResponder(reqId, ip.Host.ID())
+		}
+	}
+	var children []peer.ID
+	var childEnvelope *pb.IntelligenceReqEnvelope
+
+	// update envelope (deadline and ttl) and select peers to send it further
+	// into the network if children have enough time to respond
+	if e.Ttl != 0 {
+		if time.Until(waitUntil) < ip.settings.MinForwardBudget {
+			log.Debugf("not forwarding intelligence request, only %s left to respond", time.Until(waitUntil))
 		} else {
-			waitForResponses += ip.forwardP2PRequest(updatedMsg)
+			childEnvelope = ip.updateEnvelope(e, waitUntil)
+			children = ip.selectChildren(childEnvelope, rights)
 		}
 	}
 
-	// start waiter, who will process all responses when they are aggregated or timeout elapses
-	waitTimeout, err := time.ParseDuration(e.ParentTimeout)
+	// children are added before the request is forwarded, so their fast
+	// responses are not dropped. Request cancelled meanwhile is not forwarded
+	if !ip.setChildren(reqId, children) {
+		children = nil
+	}
+	err = ip.respStorage.CloseResponders(reqId, children)
 	if err != nil {
-		log.Errorf("using default timeout, error parsing waiting timeout after update: %s", err)
-		waitTimeout = time.Second * 3
+		return err
 	}
-
-	reqId := e.IntelligenceRequest.Metadata.Id
-	err = ip.respStorage.StartWaiting(ip.ctx, reqId, &utils.StorageMetadata{ResponsesReceiver: sender}, waitForResponses, waitTimeout)
-	return err
+	if len(children) > 0 {
+		ip.forwardP2PRequest(reqId, childEnvelope, children)
+	}
+	return nil
 }
 
-func (ip *IntelligenceProtocol) updateEnvelope(e *pb.IntelligenceReqEnvelope) (*pb.IntelligenceReqEnvelope, error) {
-	// TODO change the way how ttl and timeout is decreased/updated and use max timeout settings field
-	// TODO maybe decide not to forward the message if parent timeout is too small
-	// decrease timeout if possible
-	parentTimeout, err := time.ParseDuration(e.ParentTimeout)
+// ###############################################
+// ### Responding from cache of TL's responses ###
+// ###############################################
+func (ip *IntelligenceProtocol) respondFromCache(requestId string, payload interface{}) error {
+	fakeResp, err := ip.createFakeIntelResponse(&RedisTl2NlIntelResponse{
+		RequestId: requestId,
+		Payload:   payload,
+	})
 	if err != nil {
-		return nil, err
+		return errors.WithMessage(err, "error creating intelligence response from cache: ")
 	}
-	secondLess := parentTimeout - time.Second
-	if secondLess > 0 {
-		e.ParentTimeout = secondLess.String()
-	} else {
-		e.ParentTimeout = time.Second.String()
+	return ip.respStorage.AddResponse(requestId, ip.Host.ID(), fakeResp)
+}
+
+func (ip *IntelligenceProtocol) cachedResponse(cacheKey string) (interface{}, bool) {
+	if ip.respCache == nil || cacheKey == "" {
+		return nil, false
 	}
+	return ip.respCache.Get(cacheKey)
+}
+
+// cacheResponse stores TL's response under cache key of the request if TL
+// allowed caching
+func (ip *IntelligenceProtocol) cacheResponse(resp *RedisTl2NlIntelResponse) {
+	cacheKey := ip.takeCacheKey(resp.RequestId)
+	if ip.respCache == nil || cacheKey == "" || resp.CacheTtl <= 0 {
+		return
+	}
+	ttl := time.Duration(resp.CacheTtl) * time.Second
+	if ttl > ip.settings.MaxResponseCacheTtl {
+		ttl = ip.settings.MaxResponseCacheTtl
+	}
+	ip.respCache.Put(cacheKey, resp.Payload, ttl)
+}
+
+func (ip *IntelligenceProtocol) setCacheKey(requestId, cacheKey string) {
+	if ip.respCache == nil || cacheKey == "" {
+		return
+	}
+	ip.cacheKeysLock.Lock()
+	defer ip.cacheKeysLock.Unlock()
+	ip.cacheKeys[requestId] = cacheKey
+}
+
+func (ip *IntelligenceProtocol) takeCacheKey(requestId string) string {
+	ip.cacheKeysLock.Lock()
+	defer ip.cacheKeysLock.Unlock()
+	cacheKey := ip.cacheKeys[requestId]
+	delete(ip.cacheKeys, requestId)
+	return cacheKey
+}
+
+// parentDeadline returns time until when parent waits for the response. It is
+// clamped by MaxParentTimeout, so the parent cannot make me wait forever
+func (ip *IntelligenceProtocol) parentDeadline(e *pb.IntelligenceReqEnvelope) time.Time {
+	deadline := time.UnixMilli(e.Deadline)
+	maxDeadline := time.Now().Add(ip.settings.MaxParentTimeout)
+	if deadline.After(maxDeadline) {
+		return maxDeadline
+	}
+	return deadline
+}
+
+// updateEnvelope sets deadline for children to the time I stop waiting for
+// their responses and decreases ttl
+func (ip *IntelligenceProtocol) updateEnvelope(e *pb.IntelligenceReqEnvelope, childDeadline time.Time) *pb.IntelligenceReqEnvelope {
+	e.Deadline = childDeadline.UnixMilli()
+
 	// decrease TTL if possible
 	ttlLess := e.Ttl - 1
 	if ttlLess > ip.settings.MaxTtl {
@@ -485,34 +844,357 @@ func (ip *IntelligenceProtocol) updateEnvelope(e *pb.IntelligenceReqEnvelope) (*
 	} else {
 		e.Ttl = ttlLess
 	}
-	return e, nil
+	e.Depth++
+	return e
 }
 
-func (ip *IntelligenceProtocol) forwardP2PRequest(intelReqEnv *pb.IntelligenceReqEnvelope) int {
-	sent := 0
+// selectChildren selects peers to forward the request to and marks them as
+// peers who have seen it
+func (ip *IntelligenceProtocol) selectChildren(intelReqEnv *pb.IntelligenceReqEnvelope, rights []*org.Org) []peer.ID {
+	// do not ask peers that are known to have already seen the request
+	seen := make(map[peer.ID]struct{})
+	receivedFrom, _ := ip.SeenMessagesCache.SenderOf(intelReqEnv.IntelligenceRequest.Metadata.Id)
+	seen[receivedFrom] = struct{}{}
+	if requester, err := peer.Decode(intelReqEnv.IntelligenceRequest.Metadata.OriginalSender.NodeId); err == nil {
+		seen[requester] = struct{}{}
+	}
+	for _, rawPid := range intelReqEnv.SeenBy {
+		if pid, err := peer.Decode(rawPid); err == nil {
+			seen[pid] = struct{}{}
+		}
+	}
 
-	pids, err := ip.GetNPeersExpProbAllAllow(ip.ConnectedPeers(), numberOfRecipients)
+	pids, err := ip.selectRecipients(intelReqEnv, ip.fanout.Fanout(intelReqEnv.Depth), rights, seen)
 	if err != nil {
-		log.Errorf("error getting n peers from connected peers %s", err)
-		return sent
+		log.Errorf("error selecting recipients of intelligence request: %s", err)
+		return nil
 	}
+	for _, pid := range pids {
+		intelReqEnv.SeenBy = append(intelReqEnv.SeenBy, pid.String())
+	}
+	return pids
+}
 
-	receivedFrom, _ := ip.SeenMessagesCache.SenderOf(intelReqEnv.IntelligenceRequest.Metadata.Id)
+// forwardP2PRequest sends the request to children. Responses of children the
+// request could not be sent to are not waited for
+func (ip *IntelligenceProtocol) forwardP2PRequest(requestId string, intelReqEnv *pb.IntelligenceReqEnvelope, children []peer.ID) {
+	for _, pid := range children {
+		log.Debugf("sending intelligence request to peer %s", pid)
+		err := ip.SendProtoMessage(pid, p2pIntelRequestProtocol, intelReqEnv)
+		if err != nil {
+			log.Errorf("error sending intelligence request to node %s: %s", pid, err)
+			_ = ip.respStorage.RemoveResponder(requestId, pid)
+		}
+	}
+}
 
-	// send intelligence request to receivers
+// selectRecipients selects n peers to send the request to. Experts in topic
+// of the request are preferred, the rest are reliable connected peers. Peers
+// in seen are not selected and the selected ones are added to it
+func (ip *IntelligenceProtocol) selectRecipients(e *pb.IntelligenceReqEnvelope, n int, rights []*org.Org, seen map[peer.ID]struct{}) ([]peer.ID, error) {
+	experts, err := ip.topicExperts(e, n, rights, seen)
+	if err != nil {
+		return nil, err
+	}
+	for _, pid := range experts {
+		seen[pid] = struct{}{}
+	}
+	neighbours, err := ip.GetNPeersExpProb(ip.ConnectedPeers(), n-len(experts), rights, seen)
+	if err != nil {
+		return nil, err
+	}
+	for _, pid := range neighbours {
+		seen[pid] = struct{}{}
+	}
+	return append(experts, neighbours...), nil
+}
 
-	for _, pid := range pids {
-		if pid == receivedFrom {
+// topicExperts looks up in DHT at most n peers advertising expertise in topic
+// of the request. The lookup is bounded by TopicLookupTimeout and deadline of
+// the request
+func (ip *IntelligenceProtocol) topicExperts(e *pb.IntelligenceReqEnvelope, n int, rights []*org.Org, seen map[peer.ID]struct{}) ([]peer.ID, error) {
+	topic := e.IntelligenceRequest.Topic
+	if topic == "" || n <= 0 {
+		return nil, nil
+	}
+	c, err := topicCid(topic)
+	if err != nil {
+		return nil, errors.WithMessage(err, "error converting topic to cid: ")
+	}
+
+	deadline := time.Now().Add(ip.settings.TopicLookupTimeout)
+	if reqDeadline := time.UnixMilli(e.Deadline); reqDeadline.Before(deadline) {
+		deadline = reqDeadline
+	}
+	ctx, cancel := context.WithDeadline(ip.ctx, deadline)
+	defer cancel()
+
+	// ask for more providers as some of them might have already seen the request
+	providers := ip.Dht.GetNProvidersOf(ctx, c, n+len(seen)+1)
+	candidates := make([]peer.ID, 0, len(providers))
+	for _, p := range providers {
+		if p.ID == ip.Host.ID() {
 			continue
 		}
+		ip.Host.Peerstore().AddAddrs(p.ID, p.Addrs, peerstore.TempAddrTTL)
+		candidates = append(candidates, p.ID)
+	}
+	log.Debugf("found %d experts in intelligence topic %s", len(candidates), topic)
+	return ip.GetNPeersExpProb(candidates, n, rights, seen)
+}
 
-		log.Debugf("sending intelligence request to peer %s", pid)
-		err := ip.SendProtoMessage(pid, p2pIntelRequestProtocol, intelReqEnv)
+// AdvertiseTopics tells the network which intelligence topics I am expert in
+func (ip *IntelligenceProtocol) AdvertiseTopics() {
+	for _, topic := range ip.settings.Topics {
+		c, err := topicCid(topic)
 		if err != nil {
-			log.Errorf("error sending intelligence request to node %s: %s", pid, err)
+			log.Errorf("error converting topic to cid: %s", err)
 			continue
 		}
-		sent++
+		err = ip.Dht.StartProviding(c)
+		if err != nil {
+			log.Errorf("error putting myself as expert in topic %s to a DHT: %s", topic, err)
+		}
+	}
+}
+
+func topicCid(topic string) (cid.Cid, error) {
+	return cid.V0Builder.Sum(cid.V0Builder{}, []byte("intelligence-topic/"+topic))
+}
+
+// ####################################################
+// ### TL does not need more intelligence responses ###
+// ####################################################
+func (ip *IntelligenceProtocol) onRedisIntelligenceCancel(data []byte) {
+	req := RedisTl2NlIntelCancel{}
+	err := json.Unmarshal(data, &req)
+	if err != nil {
+		log.Errorf("error unmarshalling RedisTl2NlIntelCancel from redis: %s", err)
+		return
+	}
+	log.Debug("received intelligence cancel from TL")
+
+	fr := ip.trackedRequest(req.RequestId)
+	if fr == nil || fr.requester != ip.Host.ID() {
+		log.Errorf("cannot cancel intelligence request %s, it is not pending request of this peer", req.RequestId)
+		return
+	}
+	cancel, err := ip.createP2PIntelCancel(req.RequestId)
+	if err != nil {
+		log.Errorf("error creating p2p intelligence cancel: %s", err)
+		return
+	}
+	ip.SeenMessagesCache.NewMsgSeen(cancel.Metadata.Id, ip.Host.ID())
+	ip.cancelRequest(cancel)
+}
+
+func (ip *IntelligenceProtocol) createP2PIntelCancel(requestId string) (*pb.IntelligenceCancel, error) {
+	msgMetaData, err := ip.NewProtoMetaData()
+	if err != nil {
+		return nil, errors.WithMessage(err, "error generating new proto metadata: ")
+	}
+	cancel := &pb.IntelligenceCancel{
+		Metadata:  msgMetaData,
+		RequestId: requestId,
+	}
+	signature, err := ip.SignProtoMessage(cancel)
+	if err != nil {
+		return nil, errors.WithMessage(err, "error generating signature for new p2p intelligence cancel: ")
+	}
+	cancel.Metadata.Signature = signature
+	return cancel, nil
+}
+
+// ###########################################################
+// ### Parent peer cancels intelligence request it sent me ###
+// ###########################################################
+func (ip *IntelligenceProtocol) onP2PCancel(s network.Stream) {
+	log.Infof("received p2p intelligence cancel")
+	cancel := &pb.IntelligenceCancel{}
+
+	err := ip.DeserializeMessageFromStream(s, cancel, true)
+	if err != nil {
+		log.Errorf("error deserilising p2p intelligence cancel from stream: %s", err)
+		return
+	}
+	err = ip.AuthenticateMessage(cancel, cancel.Metadata)
+	if err != nil {
+		log.Errorf("error authenticating p2p intelligence cancel: %s", err)
+		return
+	}
+	if ip.SeenMessagesCache.WasMsgSeen(cancel.Metadata.Id) {
+		log.Debugf("received already seen intelligence cancel with id %s", cancel.Metadata.Id)
+		return
+	}
+	ip.SeenMessagesCache.NewMsgSeen(cancel.Metadata.Id, s.Conn().RemotePeer())
+
+	err = ip.processP2PCancel(cancel, s.Conn().RemotePeer())
+	if err != nil {
+		log.Errorf("error processing p2p intelligence cancel: %s", err)
+		return
+	}
+	log.Debug("handler onP2PCancel successfully ended")
+}
+
+func (ip *IntelligenceProtocol) processP2PCancel(cancel *pb.IntelligenceCancel, sender peer.ID) error {
+	// cancel has to follow the forwarding tree, only the peer I received
+	// the request from can cancel it
+	parent, seen := ip.SeenMessagesCache.SenderOf(cancel.RequestId)
+	if !seen || parent != sender {
+		return errors.Errorf("peer %s did not send me intelligence request %s", sender, cancel.RequestId)
+	}
+	fr := ip.trackedRequest(cancel.RequestId)
+	if fr == nil {
+		log.Debugf("intelligence request %s is not pending anymore, ignoring cancel", cancel.RequestId)
+		return nil
+	}
+	author, err := peer.Decode(cancel.Metadata.OriginalSender.NodeId)
+	if err != nil {
+		return errors.WithMessage(err, "error decoding peer ID of cancel author: ")
+	}
+	if author != fr.requester {
+		return errors.Errorf("peer %s tried to cancel intelligence request %s of peer %s",
+			author, cancel.RequestId, fr.requester)
+	}
+	ip.cancelRequest(cancel)
+	return nil
+}
+
+// cancelRequest sends the cancel to all peers I forwarded the request to and
+// stops waiting for their responses
+func (ip *IntelligenceProtocol) cancelRequest(cancel *pb.IntelligenceCancel) {
+	children := ip.markCancelled(cancel.RequestId)
+	for _, pid := range children {
+		log.Debugf("sending intelligence cancel to peer %s", pid)
+		err := ip.SendProtoMessage(pid, p2pIntelCancelProtocol, cancel)
+		if err != nil {
+			log.Errorf("error sending intelligence cancel to node %s: %s", pid, err)
+		}
+	}
+	err := ip.respStorage.FinishEarly(cancel.RequestId)
+	if err != nil {
+		log.Errorf("error finishing intelligence request %s early: %s", cancel.RequestId, err)
+	}
+}
+
+func (ip *IntelligenceProtocol) trackRequest(requestId string, requester peer.ID, children []peer.ID) {
+	ip.forwardLock.Lock()
+	defer ip.forwardLock.Unlock()
+	ip.forwarded[requestId] = &forwardedRequest{
+		requester: requester,
+		children:  children,
+	}
+}
+
+// setChildren sets peers the tracked request is forwarded to. It returns
+// false if the request was cancelled meanwhile
+func (ip *IntelligenceProtocol) setChildren(requestId string, children []peer.ID) bool {
+	ip.forwardLock.Lock()
+	defer ip.forwardLock.Unlock()
+	fr, exists := ip.forwarded[requestId]
+	if !exists || fr.cancelled {
+		return false
+	}
+	fr.children = children
+	return true
+}
+
+func (ip *IntelligenceProtocol) trackedRequest(requestId string) *forwardedRequest {
+	ip.forwardLock.Lock()
+	defer ip.forwardLock.Unlock()
+	fr, exists := ip.forwarded[requestId]
+	if !exists {
+		return nil
+	}
+	frCopy := *fr
+	return &frCopy
+}
+
+// markCancelled marks the request as cancelled and returns peers it was
+// forwarded to. Peers are returned only once, so cancel is not sent twice
+func (ip *IntelligenceProtocol) markCancelled(requestId string) []peer.ID {
+	ip.forwardLock.Lock()
+	defer ip.forwardLock.Unlock()
+	fr, exists := ip.forwarded[requestId]
+	if !exists || fr.cancelled {
+		return nil
+	}
+	fr.cancelled = true
+	return fr.children
+}
+
+// untrackRequest stops tracking the request and returns whether it was cancelled
+func (ip *IntelligenceProtocol) untrackRequest(requestId string) bool {
+	ip.forwardLock.Lock()
+	defer ip.forwardLock.Unlock()
+	fr, exists := ip.forwarded[requestId]
+	if !exists {
+		return false
+	}
+	delete(ip.forwarded, requestId)
+	return fr.cancelled
+}
+
+func (ip *IntelligenceProtocol) setRequestRights(requestId string, rights []*org.Org) {
+	if len(rights) == 0 {
+		return
+	}
+	ip.rightsLock.Lock()
+	defer ip.rightsLock.Unlock()
+	ip.requestRights[requestId] = rights
+}
+
+func (ip *IntelligenceProtocol) rightsOfRequest(requestId string) []*org.Org {
+	ip.rightsLock.Lock()
+	defer ip.rightsLock.Unlock()
+	return ip.requestRights[requestId]
+}
+
+func (ip *IntelligenceProtocol) deleteRequestRights(requestId string) {
+	ip.rightsLock.Lock()
+	defer ip.rightsLock.Unlock()
+	delete(ip.requestRights, requestId)
+}
+
+// authorizingOrgSigs returns my signatures of organisations that are in
+// rights. They prove I am allowed to respond to org-scoped request
+func (ip *IntelligenceProtocol) authorizingOrgSigs(rights []*org.Org) []*pb.Organisation {
+	if len(rights) == 0 {
+		return nil
+	}
+	sigs := make([]*pb.Organisation, 0)
+	for i, o := range ip.OrgBook.MyOrgs {
+		for _, r := range rights {
+			if *o == *r {
+				sigs = append(sigs, ip.OrgBook.MySignaturesProto[i])
+				break
+			}
+		}
+	}
+	return sigs
+}
+
+// isAuthorizedResponder returns true if at least one of the provided org
+// signatures is a valid signature of responder by organisation from rights
+func isAuthorizedResponder(responder peer.ID, sigs []*pb.Organisation, rights []*org.Org) bool {
+	for _, sig := range sigs {
+		o, err := org.Decode(sig.OrgId)
+		if err != nil {
+			continue
+		}
+		inRights := false
+		for _, r := range rights {
+			if *o == *r {
+				inRights = true
+				break
+			}
+		}
+		if !inRights {
+			continue
+		}
+		if ok, err := o.VerifyPeer(responder, sig.Signature); err == nil && ok {
+			return true
+		}
 	}
-	return sent
+	return false
 }
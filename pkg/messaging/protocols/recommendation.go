@@ -3,20 +3,21 @@ package protocols
 import (
 	"context"
 	"encoding/json"
+	"time"
 
 	"github.com/golang/protobuf/proto"
-	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
-	"github.com/pkg/errors"
 
 	"happystoic/p2pnetwork/pkg/config"
 	"happystoic/p2pnetwork/pkg/messaging/pb"
 	"happystoic/p2pnetwork/pkg/messaging/utils"
 )
 
-// p2p protocol definition
-const p2pRecomRequestProtocol = "/recommendation-request/0.0.1"
-const p2pRecomResponseProtocol = "/recommendation-response/0.0.1"
+// name of the p2p rpc protocol
+const p2pRecomRpcName = "recommendation"
+
+// maxPendingRecomRequests bounds number of received requests waiting for TL
+const maxPendingRecomRequests = 1000
 
 type RedisTl2NlRecommendationRequest struct {
 	ReceiverIds []string    `json:"receiver_ids"`
@@ -45,9 +46,11 @@ type Recommendation struct {
 type RecommendationProtocol struct {
 	*utils.ProtoUtils
 
-	ctx         context.Context
-	respStorage *utils.ResponseAggregator
-	settings    *config.RecommendationSettings
+	rpc      *utils.Rpc
+	settings *config.RecommendationSettings
+
+	// received requests waiting for response of TL by their ID
+	pending *utils.TtlCache
 }
 
 func NewRecommendationProtocol(ctx context.Context,
@@ -55,44 +58,41 @@ func NewRecommendationProtocol(ctx context.Context,
 	c *config.RecommendationSettings) *RecommendationProtocol {
 	rp := &RecommendationProtocol{
 		ProtoUtils: pu,
-		ctx:        ctx,
 		settings:   c,
+		pending:    utils.NewTtlCache(maxPendingRecomRequests),
 	}
-	rp.respStorage = utils.NewResponseAggregator(rp.onAggregatedP2PResponses)
+	rp.rpc = utils.NewRpc(ctx, pu, p2pRecomRpcName,
+		func() proto.Message { return &pb.RecommendationRequest{} },
+		func() proto.Message { return &pb.RecommendationResponse{} },
+		rp.onP2PRequest)
 
 	_ = rp.RedisClient.SubscribeCallback("tl2nl_recommendation_request", rp.onRedisRecommendationRequest)
 	_ = rp.RedisClient.SubscribeCallback("tl2nl_recommendation_response", rp.onRedisRecommendationResponse)
-	rp.Host.SetStreamHandler(p2pRecomRequestProtocol, rp.onP2PRequest)
-	rp.Host.SetStreamHandler(p2pRecomResponseProtocol, rp.onP2PResponse)
 	return rp
 }
 
-func (rp *RecommendationProtocol) onP2PRequest(s network.Stream) {
-	log.Infof("received p2p recommendation request")
-	recomReq := &pb.RecommendationRequest{}
+// PeerDisconnected stops waiting for recommendation responses of disconnected peer
+func (rp *RecommendationProtocol) PeerDisconnected(p peer.ID) {
+	rp.rpc.PeerDisconnected(p)
+}
 
-	err := rp.DeserializeMessageFromStream(s, recomReq, true)
-	if err != nil {
-		log.Errorf("error deserilising p2p recommendation request from stream: %s", err)
-		return
-	}
+func (rp *RecommendationProtocol) onP2PRequest(req *utils.RpcIncomingRequest) {
+	log.Infof("received p2p recommendation request")
+	recomReq := req.Request.(*pb.RecommendationRequest)
 
-	err = rp.AuthenticateMessage(recomReq, recomReq.Metadata)
-	if err != nil {
-		log.Errorf("error authenticating p2P recommendation request: %s", err)
-		return
-	}
 	var v interface{}
 	if err := json.Unmarshal(recomReq.Payload, &v); err != nil {
 		log.Errorf("error deserialising received payload in p2p recommendation request: %s", err)
 		return
 	}
+	rp.pending.Put(req.Id, req, time.Until(req.Deadline))
+
 	requestToRedis := RedisNl2TlRecommendationRequest{
-		RequestId: recomReq.Metadata.Id,
-		Sender:    rp.MetadataOfPeer(s.Conn().RemotePeer()),
+		RequestId: req.Id,
+		Sender:    rp.MetadataOfPeer(req.Sender),
 		Payload:   v,
 	}
-	err = rp.RedisClient.PublishMessage("nl2tl_recommendation_request", requestToRedis)
+	err := rp.RedisClient.PublishMessage("nl2tl_recommendation_request", requestToRedis)
 	if err != nil {
 		log.Errorf("error publishing recommendation request to TL: %s", err)
 		return
@@ -100,52 +100,22 @@ func (rp *RecommendationProtocol) onP2PRequest(s network.Stream) {
 	log.Debug("onP2PRequest handler successfully ended")
 }
 
-func (rp *RecommendationProtocol) onP2PResponse(s network.Stream) {
-	log.Infof("received p2p recommendation response")
-	recomResp := &pb.RecommendationResponse{}
-
-	err := rp.DeserializeMessageFromStream(s, recomResp, true)
-	if err != nil {
-		log.Errorf("error deserilising p2P recommendation response from stream: %s", err)
-		return
-	}
-
-	err = rp.AuthenticateMessage(recomResp, recomResp.Metadata)
-	if err != nil {
-		log.Errorf("error authenticating p2P recommendation response: %s", err)
-		return
-	}
-	err = rp.respStorage.AddResponse(recomResp.RequestId, recomResp)
-	if err != nil {
-		log.Errorf("error adding response to respStorage with id '%s': '%s'", recomResp.RequestId, err)
-		return
-	}
-	log.Debug("p2p recommendation response was successfully put into response storage")
-}
-
-func (rp *RecommendationProtocol) onAggregatedP2PResponses(_ string, responses []proto.Message, _ *utils.StorageMetadata) {
-	if len(responses) == 0 {
+func (rp *RecommendationProtocol) onRpcResults(_ string, results []*utils.RpcResult) {
+	if len(results) == 0 {
 		log.Errorf("aggregated zero responses, not sending any response to Redis")
 		return
 	}
-	recomRedisResp := make(RedisNl2TlRecommendationResponse, 0, len(responses))
-	for i := range responses {
-		resp := pb.RecommendationResponse{}
-		bytes, _ := proto.Marshal(responses[i])
-		_ = proto.Unmarshal(bytes, &resp)
+	recomRedisResp := make(RedisNl2TlRecommendationResponse, 0, len(results))
+	for _, result := range results {
+		resp := result.Response.(*pb.RecommendationResponse)
 
 		var v interface{}
 		if err := json.Unmarshal(resp.Payload, &v); err != nil {
 			log.Errorf("error deserialising received payload in p2p recommendation response: %s", err)
 			continue
 		}
-
-		senderPeerId, err := peer.Decode(resp.Metadata.OriginalSender.NodeId)
-		if err != nil {
-			log.Errorf("error decoding peer ID: %s", err)
-		}
 		recomRedisResp = append(recomRedisResp, &Recommendation{
-			Sender:  rp.MetadataOfPeer(senderPeerId),
+			Sender:  rp.MetadataOfPeer(result.Responder),
 			Payload: v,
 		})
 	}
@@ -154,7 +124,7 @@ func (rp *RecommendationProtocol) onAggregatedP2PResponses(_ string, responses [
 		log.Errorf("error publishing recommendation response to TL: %s", err)
 		return
 	}
-	log.Debug("onAggregatedP2PResponses handler successfully ended")
+	log.Debug("onRpcResults handler successfully ended")
 }
 
 func (rp *RecommendationProtocol) onRedisRecommendationRequest(data []byte) {
@@ -173,55 +143,33 @@ func (rp *RecommendationProtocol) initiateP2PRecomRequest(req *RedisTl2NlRecomme
 		log.Warn("no receivers specified for recommendation request")
 		return
 	}
-	p2pRequest, err := rp.createP2PRecomRequest(req.Payload)
+	payloadBytes, err := json.Marshal(req.Payload)
 	if err != nil {
-		log.Errorf("error creating p2p recommendation request: %s", err)
+		log.Errorf("error marshalling payload of recommendation request: %s", err)
 		return
 	}
-	// start waiter, who will process all responses when they are aggregated or timeout elapses
-	err = rp.respStorage.StartWaiting(rp.ctx, p2pRequest.Metadata.Id, nil, len(req.ReceiverIds), rp.settings.Timeout)
-	if err != nil {
-		log.Errorf("error when starting to wait for recommendation responses: %s", err)
-		return
-	}
-
-	// send recommendation request to receivers
+	receivers := make([]peer.ID, 0, len(req.ReceiverIds))
 	for _, rawPid := range req.ReceiverIds {
 		pid, err := peer.Decode(rawPid)
 		if err != nil {
 			log.Errorf("error decoding peer id %s: %s", rawPid, err)
 			continue
 		}
-
-		log.Debugf("sending recommendation request to peer %s", pid)
-		err = rp.SendProtoMessage(pid, p2pRecomRequestProtocol, p2pRequest)
-		if err != nil {
-			log.Errorf("error sending recommendation request to node %s: %s", pid, err)
-			continue
-		}
+		receivers = append(receivers, pid)
 	}
-}
-
-func (rp *RecommendationProtocol) createP2PRecomRequest(payload interface{}) (*pb.RecommendationRequest, error) {
-	payloadBytes, err := json.Marshal(payload)
-	if err != nil {
-		return nil, err
-	}
-	msgMetaData, err := rp.NewProtoMetaData()
-	if err != nil {
-		return nil, errors.WithMessage(err, "error generating new proto metadata: ")
+	if len(receivers) == 0 {
+		log.Warn("no valid receivers specified for recommendation request")
+		return
 	}
 
-	protoMsg := &pb.RecommendationRequest{
-		Metadata: msgMetaData,
-		Payload:  payloadBytes,
+	opts := &utils.CallOptions{
+		Peers:   receivers,
+		Timeout: rp.settings.Timeout,
 	}
-	signature, err := rp.SignProtoMessage(protoMsg)
+	_, err = rp.rpc.Call(&pb.RecommendationRequest{Payload: payloadBytes}, opts, rp.onRpcResults)
 	if err != nil {
-		return nil, errors.WithMessage(err, "error generating signature for new p2p recommendation request: ")
+		log.Errorf("error sending recommendation request: %s", err)
 	}
-	protoMsg.Metadata.Signature = signature
-	return protoMsg, err
 }
 
 func (rp *RecommendationProtocol) onRedisRecommendationResponse(data []byte) {
@@ -233,45 +181,28 @@ func (rp *RecommendationProtocol) onRedisRecommendationResponse(data []byte) {
 	}
 	log.Debug("received recommendation response from TL")
 
-	p2presponse, err := rp.createP2PRecomResponse(redisResponse.RequestId, redisResponse.Payload)
-	if err != nil {
-		log.Errorf("error creating p2p recommendation response: %s", err)
+	pending, exists := rp.pending.Take(redisResponse.RequestId)
+	if !exists {
+		log.Errorf("recommendation request %s is unknown or its deadline elapsed", redisResponse.RequestId)
 		return
 	}
-	pid, err := peer.Decode(redisResponse.RecipientId)
-	if err != nil {
-		log.Errorf("error decoding recipient id %s: %s", redisResponse.RecipientId, err)
+	req := pending.(*utils.RpcIncomingRequest)
+	if redisResponse.RecipientId != req.Sender.String() {
+		log.Errorf("recommendation request %s was sent by %s, not by recipient %s", req.Id, req.Sender,
+			redisResponse.RecipientId)
 		return
 	}
-
-	log.Debugf("sending recommendation response to recipient %s", pid)
-	err = rp.SendProtoMessage(pid, p2pRecomResponseProtocol, p2presponse)
+	payloadBytes, err := json.Marshal(redisResponse.Payload)
 	if err != nil {
-		log.Errorf("error sending recommendation response to node %s: %s", pid, err)
+		log.Errorf("error marshalling payload of recommendation response: %s", err)
 		return
 	}
-	log.Debugf("handler onRedisRecommendationResponse successfully ended")
-}
 
-func (rp *RecommendationProtocol) createP2PRecomResponse(requstId string, payload interface{}) (*pb.RecommendationResponse, error) {
-	payloadBytes, err := json.Marshal(payload)
-	if err != nil {
-		return nil, err
-	}
-	msgMetaData, err := rp.NewProtoMetaData()
+	log.Debugf("sending recommendation response to recipient %s", req.Sender)
+	err = req.Respond(&pb.RecommendationResponse{Payload: payloadBytes})
 	if err != nil {
-		return nil, errors.WithMessage(err, "error generating new proto metadata: ")
-	}
-
-	protoMsg := &pb.RecommendationResponse{
-		RequestId: requstId,
-		Metadata:  msgMetaData,
-		Payload:   payloadBytes,
-	}
-	signature, err := rp.SignProtoMessage(protoMsg)
-	if err != nil {
-		return nil, errors.WithMessage(err, "error generating signature for new p2p recommendation response: ")
+		log.Errorf("error sending recommendation response to node %s: %s", req.Sender, err)
+		return
 	}
-	protoMsg.Metadata.Signature = signature
-	return protoMsg, err
+	log.Debugf("handler onRedisRecommendationResponse successfully ended")
 }
@@ -22,7 +22,7 @@ type SpreadStrategy struct {
 
 type SpreadStrategies map[files.Severity]*SpreadStrategy
 
-var defaultStrategies = map[files.Severity]*SpreadStrategy{
+var defaultFileMetaStrategies = SpreadStrategies{
 	files.MINOR: {
 		numberOfPeers: 2,
 		every:         time.Minute * 20,
@@ -40,15 +40,42 @@ var defaultStrategies = map[files.Severity]*SpreadStrategy{
 	},
 }
 
+var defaultAlertStrategies = SpreadStrategies{
+	files.MINOR: {
+		numberOfPeers: 3,
+		every:         0,
+		until:         0,
+	},
+	files.MAJOR: {
+		numberOfPeers: 6,
+		every:         time.Minute * 5,
+		until:         time.Minute * 30,
+	},
+	files.CRITICAL: {
+		numberOfPeers: 12,
+		every:         time.Minute * 2,
+		until:         time.Minute * 30,
+	},
+}
+
 type Spreader struct {
 	*utils.ProtoUtils
 
 	ctx            context.Context
-	pushStrategies map[files.Severity]*SpreadStrategy
+	pushStrategies SpreadStrategies
 }
 
-func NewSpreader(ctx context.Context, pu *utils.ProtoUtils, cfg map[string]config.SpreadStrategy) *Spreader {
-	strategies := defaultStrategies
+// NewSpreader creates spreader with given default strategies which are
+// overridden by strategies from configuration
+func NewSpreader(ctx context.Context, pu *utils.ProtoUtils, defaults SpreadStrategies,
+	cfg map[string]config.SpreadStrategy) *Spreader {
+
+	// copy the defaults, so they are not modified by the configuration
+	strategies := make(SpreadStrategies, len(defaults))
+	for sev, strategy := range defaults {
+		s := *strategy
+		strategies[sev] = &s
+	}
 	for rawSev, strategy := range cfg {
 		// severity format should be already validated in config package
 		sev, _ := files.SeverityFromString(rawSev)
@@ -66,7 +93,8 @@ func (s *Spreader) spread(protocol protocol.ID,
 	nPeers int,
 	rights []*org.Org,
 	visited map[peer.ID]struct{},
-	msg proto.Message) {
+	msg proto.Message,
+	onSent func(peer.ID)) {
 
 	// select n random recipients
 	peers, err := s.GetNPeersExpProb(s.ConnectedPeers(), nPeers, rights, visited)
@@ -74,44 +102,61 @@ func (s *Spreader) spread(protocol protocol.ID,
 		log.Errorf("error getting n peers from connected peers %s", err)
 		return
 	}
-	log.Debugf("spreading file meta to %d peers", len(peers))
+	log.Debugf("spreading %s message to %d peers", protocol, len(peers))
 	for _, p := range peers {
 		err := s.SendProtoMessage(p, protocol, msg)
 		if err != nil {
-			log.Errorf("error spreading file meta to peer %s: %s", p.String(), err)
+			log.Errorf("error spreading %s message to peer %s: %s", protocol, p.String(), err)
 		} else {
-			log.Debugf("successfully spread file meta to peer %s", p.String())
+			log.Debugf("successfully spread %s message to peer %s", protocol, p.String())
+			if onSent != nil {
+				onSent(p)
+			}
 		}
 		visited[p] = struct{}{}
 	}
 	log.Debugf("spreading finished")
 }
 
-// TODO: do not use "file meta" in in logging if alert proto gonna use this too
-//       it's just confusing...
+// startSpreading periodically sends msg to random peers in a goroutine based
+// on strategy of given severity. Peers are weighted by their reliability.
+// Returned function can be used to stop the spreading prematurely. Optional
+// onSent is called with every peer the message was sent to and optional
+// onDone is called when the spreading ends or is stopped
 func (s *Spreader) startSpreading(protocol protocol.ID,
 	sev files.Severity,
 	rights []*org.Org,
 	msg proto.Message,
-	author peer.ID) {
+	author peer.ID,
+	onSent func(peer.ID),
+	onDone func()) context.CancelFunc {
 
-	// To keep track who already knows about the file
+	// To keep track who already knows about the message
 	visited := make(map[peer.ID]struct{})
 	visited[author] = struct{}{}
 
+	ctx, cancel := context.WithCancel(s.ctx)
 	go func() {
-		strategy := s.pushStrategies[sev]
+		defer cancel()
+		if onDone != nil {
+			defer onDone()
+		}
+		strategy, exists := s.pushStrategies[sev]
+		if !exists {
+			log.Errorf("no spreading strategy for severity %s", sev)
+			return
+		}
 
 		nPeers := strategy.numberOfPeers
 		if nPeers <= 0 {
 			// no peers configured, don't spread
 			return
 		}
-		s.spread(protocol, nPeers, rights, visited, msg)
+		s.spread(protocol, nPeers, rights, visited, msg, onSent)
 
 		if strategy.every <= 0 {
 			// periodical spreading disabled, return now
-			log.Debugf("spreading of file done")
+			log.Debugf("spreading of %s message done", protocol)
 			return
 		}
 
@@ -120,15 +165,17 @@ func (s *Spreader) startSpreading(protocol protocol.ID,
 		for {
 			select {
 			case <-ticker.C:
-				s.spread(protocol, nPeers, rights, visited, msg)
+				s.spread(protocol, nPeers, rights, visited, msg, onSent)
 			case <-timeout:
 				ticker.Stop()
-				log.Debugf("spreading of file done")
+				log.Debugf("spreading of %s message done", protocol)
 				return
-			case <-s.ctx.Done():
-				log.Debugf("ending file spread: context cancelled.")
+			case <-ctx.Done():
+				ticker.Stop()
+				log.Debugf("ending %s message spread: context cancelled.", protocol)
 				return
 			}
 		}
 	}()
+	return cancel
 }
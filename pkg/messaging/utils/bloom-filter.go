@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"hash/fnv"
+	"math"
+
+	"github.com/pkg/errors"
+)
+
+// maxBloomFilterHashes bounds number of hash functions of a received filter,
+// so a peer cannot make us compute arbitrary number of hashes
+const maxBloomFilterHashes = 32
+
+// BloomFilter is a space efficient probabilistic set of strings. It can be
+// used to summarise known message IDs and send the summary to other peers.
+// False positives are possible, false negatives are not
+type BloomFilter struct {
+	bits   []byte
+	hashes uint32
+}
+
+// NewBloomFilter creates filter sized for n items with given false positive
+// probability
+func NewBloomFilter(n int, fpRate float64) *BloomFilter {
+	if n < 1 {
+		n = 1
+	}
+	m := math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2))
+	k := math.Round(m / float64(n) * math.Ln2)
+	if k < 1 {
+		k = 1
+	}
+	return &BloomFilter{
+		bits:   make([]byte, int(math.Ceil(m/8))),
+		hashes: uint32(math.Min(k, maxBloomFilterHashes)),
+	}
+}
+
+// BloomFilterFromBytes reconstructs filter received from another peer
+func BloomFilterFromBytes(bits []byte, hashes uint32) (*BloomFilter, error) {
+	if len(bits) == 0 {
+		return nil, errors.New("bloom filter has no bits")
+	}
+	if hashes == 0 || hashes > maxBloomFilterHashes {
+		return nil, errors.Errorf("invalid number of bloom filter hashes %d", hashes)
+	}
+	return &BloomFilter{bits: bits, hashes: hashes}, nil
+}
+
+// positions returns indexes of bits belonging to item s. It uses double
+// hashing technique to derive all the hashes from one 64-bit hash
+func (bf *BloomFilter) positions(s string) []uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	sum := h.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32
+
+	m := uint64(len(bf.bits) * 8)
+	positions := make([]uint64, 0, bf.hashes)
+	for i := uint64(0); i < uint64(bf.hashes); i++ {
+		positions = append(positions, (h1+i*h2)%m)
+	}
+	return positions
+}
+
+func (bf *BloomFilter) Add(s string) {
+	for _, p := range bf.positions(s) {
+		bf.bits[p/8] |= 1 << (p % 8)
+	}
+}
+
+// Test returns true if s is possibly in the filter
+func (bf *BloomFilter) Test(s string) bool {
+	for _, p := range bf.positions(s) {
+		if bf.bits[p/8]&(1<<(p%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (bf *BloomFilter) Bytes() []byte {
+	return bf.bits
+}
+
+func (bf *BloomFilter) Hashes() uint32 {
+	return bf.hashes
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBloomFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		n      int
+		fpRate float64
+	}{
+		{name: "default history size", n: 500, fpRate: 0.01},
+		{name: "single item", n: 1, fpRate: 0.01},
+		{name: "zero items", n: 0, fpRate: 0.1},
+		{name: "low false positive rate", n: 1000, fpRate: 0.0001},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bf := NewBloomFilter(tt.n, tt.fpRate)
+			if bf.Hashes() == 0 || bf.Hashes() > maxBloomFilterHashes {
+				t.Fatalf("invalid number of hashes %d", bf.Hashes())
+			}
+			for i := 0; i < tt.n; i++ {
+				bf.Add(fmt.Sprintf("added-%d", i))
+			}
+			for i := 0; i < tt.n; i++ {
+				if !bf.Test(fmt.Sprintf("added-%d", i)) {
+					t.Fatalf("added item %d is not in the filter", i)
+				}
+			}
+
+			// filter sent to another peer must give the same answers
+			received, err := BloomFilterFromBytes(bf.Bytes(), bf.Hashes())
+			if err != nil {
+				t.Fatalf("error reconstructing filter: %s", err)
+			}
+			falsePositives, tested := 0, 10000
+			for i := 0; i < tested; i++ {
+				item := fmt.Sprintf("missing-%d", i)
+				if received.Test(item) != bf.Test(item) {
+					t.Fatalf("reconstructed filter differs for %s", item)
+				}
+				if bf.Test(item) {
+					falsePositives++
+				}
+			}
+			// the rate is checked only for filters large enough to behave
+			// statistically
+			if rate := float64(falsePositives) / float64(tested); tt.n >= 100 && rate > 3*tt.fpRate {
+				t.Fatalf("false positive rate %f is much higher than %f", rate, tt.fpRate)
+			}
+		})
+	}
+}
+
+func TestBloomFilterFromBytes(t *testing.T) {
+	tests := []struct {
+		name    string
+		bits    []byte
+		hashes  uint32
+		wantErr bool
+	}{
+		{name: "valid filter", bits: make([]byte, 8), hashes: 3},
+		{name: "no bits", bits: []byte{}, hashes: 3, wantErr: true},
+		{name: "no hashes", bits: make([]byte, 8), hashes: 0, wantErr: true},
+		{name: "too many hashes", bits: make([]byte, 8), hashes: maxBloomFilterHashes + 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := BloomFilterFromBytes(tt.bits, tt.hashes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wanted error: %t", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+type historyEntry struct {
+	msg   proto.Message
+	added time.Time
+}
+
+// MessageHistory keeps a bounded history of recent messages by their IDs.
+// Messages older than ttl are purged and when the history is full, the oldest
+// messages are dropped
+type MessageHistory struct {
+	lock     sync.Mutex
+	maxSize  int
+	ttl      time.Duration
+	order    []string
+	messages map[string]*historyEntry
+	// onRemove is called with ID of every message leaving the history
+	onRemove func(id string)
+}
+
+// NewMessageHistory creates new history. Optional onRemove is called with ID
+// of every message which is purged or removed from the history. It is called
+// with the lock held, so it must not use the history
+func NewMessageHistory(maxSize int, ttl time.Duration, onRemove func(id string)) *MessageHistory {
+	return &MessageHistory{
+		maxSize:  maxSize,
+		ttl:      ttl,
+		order:    make([]string, 0, maxSize),
+		messages: make(map[string]*historyEntry),
+		onRemove: onRemove,
+	}
+}
+
+// Add stores message to the history. Nothing happens if there already is
+// message with given ID or the history has zero size
+func (h *MessageHistory) Add(id string, msg proto.Message) {
+	if h.maxSize <= 0 {
+		h.removed(id)
+		return
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if _, exists := h.messages[id]; exists {
+		return
+	}
+	h.messages[id] = &historyEntry{msg: msg, added: time.Now()}
+	h.order = append(h.order, id)
+	h.purge()
+}
+
+func (h *MessageHistory) Remove(id string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	// id stays in order slice and is skipped during purging
+	if _, exists := h.messages[id]; exists {
+		delete(h.messages, id)
+		h.removed(id)
+	}
+}
+
+func (h *MessageHistory) Get(id string) (proto.Message, bool) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.purge()
+
+	entry, exists := h.messages[id]
+	if !exists {
+		return nil, false
+	}
+	return entry.msg, true
+}
+
+// IDs returns IDs of all messages in the history from the oldest one
+func (h *MessageHistory) IDs() []string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.purge()
+
+	ids := make([]string, 0, len(h.messages))
+	for _, id := range h.order {
+		if _, exists := h.messages[id]; exists {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// purge drops expired and overflowing messages. Lock must be held
+func (h *MessageHistory) purge() {
+	deadline := time.Now().Add(-h.ttl)
+	for len(h.order) > 0 {
+		id := h.order[0]
+		entry, exists := h.messages[id]
+		if exists && len(h.messages) <= h.maxSize && entry.added.After(deadline) {
+			// the oldest message is valid, so are the others
+			break
+		}
+		if exists {
+			delete(h.messages, id)
+			h.removed(id)
+		}
+		h.order = h.order[1:]
+	}
+}
+
+func (h *MessageHistory) removed(id string) {
+	if h.onRemove != nil {
+		h.onRemove(id)
+	}
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"happystoic/p2pnetwork/pkg/messaging/pb"
+)
+
+func TestMessageHistory(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxSize int
+		ttl     time.Duration
+		add     []string
+		remove  []string
+		addLate []string
+		wait    time.Duration
+		ids     []string
+		removed []string
+	}{
+		{
+			name:    "keeps added messages",
+			maxSize: 3,
+			ttl:     time.Minute,
+			add:     []string{"a", "b", "a"},
+			ids:     []string{"a", "b"},
+			removed: []string{},
+		},
+		{
+			name:    "drops the oldest messages when full",
+			maxSize: 2,
+			ttl:     time.Minute,
+			add:     []string{"a", "b", "c", "d"},
+			ids:     []string{"c", "d"},
+			removed: []string{"a", "b"},
+		},
+		{
+			name:    "removed messages do not count to size",
+			maxSize: 2,
+			ttl:     time.Minute,
+			add:     []string{"a", "b"},
+			remove:  []string{"b", "unknown"},
+			addLate: []string{"c"},
+			ids:     []string{"a", "c"},
+			removed: []string{"b"},
+		},
+		{
+			name:    "purges expired messages",
+			maxSize: 3,
+			ttl:     50 * time.Millisecond,
+			add:     []string{"a", "b"},
+			wait:    100 * time.Millisecond,
+			ids:     []string{},
+			removed: []string{"a", "b"},
+		},
+		{
+			name:    "zero size history keeps nothing",
+			maxSize: 0,
+			ttl:     time.Minute,
+			add:     []string{"a"},
+			ids:     []string{},
+			removed: []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			removed := make([]string, 0)
+			h := NewMessageHistory(tt.maxSize, tt.ttl, func(id string) { removed = append(removed, id) })
+			for _, id := range tt.add {
+				h.Add(id, &pb.Alert{})
+			}
+			for _, id := range tt.remove {
+				h.Remove(id)
+			}
+			for _, id := range tt.addLate {
+				h.Add(id, &pb.Alert{})
+			}
+			time.Sleep(tt.wait)
+
+			if ids := h.IDs(); !reflect.DeepEqual(ids, tt.ids) {
+				t.Fatalf("got ids %v, expected %v", ids, tt.ids)
+			}
+			if !reflect.DeepEqual(removed, tt.removed) {
+				t.Fatalf("got removed ids %v, expected %v", removed, tt.removed)
+			}
+			for _, id := range tt.ids {
+				if _, ok := h.Get(id); !ok {
+					t.Fatalf("message %s is not in the history", id)
+				}
+			}
+		})
+	}
+}
@@ -1,8 +1,11 @@
 package utils
 
 import (
+	"bufio"
 	"context"
+	"encoding/binary"
 	"happystoic/p2pnetwork/pkg/dht"
+	"io"
 	"io/ioutil"
 	"sort"
 	"time"
@@ -105,8 +108,41 @@ func (pu *ProtoUtils) InitiateStream(id peer.ID, protocol protocol.ID, data prot
 	return s, nil
 }
 
-// NewProtoMetaData creates new protobuf metadata
-func (pu *ProtoUtils) NewProtoMetaData() (*pb.MetaData, error) {
+// WriteDelimitedProtoMsg writes message prefixed by its length, so more
+// messages can be sent in one stream
+func (pu *ProtoUtils) WriteDelimitedProtoMsg(data proto.Message, w io.Writer) error {
+	bytes, err := proto.Marshal(data)
+	if err != nil {
+		return err
+	}
+	lenBuf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(lenBuf, uint64(len(bytes)))
+	if _, err = w.Write(lenBuf[:n]); err != nil {
+		return err
+	}
+	_, err = w.Write(bytes)
+	return err
+}
+
+// ReadDelimitedProtoMsg reads one length prefixed message which cannot be
+// longer than maxSize bytes
+func (pu *ProtoUtils) ReadDelimitedProtoMsg(r *bufio.Reader, msg proto.Message, maxSize int) error {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	if length > uint64(maxSize) {
+		return errors.Errorf("message of size %d exceeds maximum size %d", length, maxSize)
+	}
+	buf := make([]byte, length)
+	if _, err = io.ReadFull(r, buf); err != nil {
+		return err
+	}
+	return proto.Unmarshal(buf, msg)
+}
+
+// MyIdentity creates protobuf identity of this peer
+func (pu *ProtoUtils) MyIdentity() (*pb.PeerIdentity, error) {
 	// Add protobufs bin data for message author public key
 	// this is useful for authenticating  messages forwarded by a node authored by another node
 	nodePubKey, err := crypto.MarshalPublicKey(pu.Host.Peerstore().PubKey(pu.Host.ID()))
@@ -114,9 +150,17 @@ func (pu *ProtoUtils) NewProtoMetaData() (*pb.MetaData, error) {
 		return nil, errors.New("Failed to get public key for sender from local node store.")
 	}
 
-	sender := &pb.PeerIdentity{
+	return &pb.PeerIdentity{
 		NodeId:     pu.Host.ID().String(),
 		NodePubKey: nodePubKey,
+	}, nil
+}
+
+// NewProtoMetaData creates new protobuf metadata
+func (pu *ProtoUtils) NewProtoMetaData() (*pb.MetaData, error) {
+	sender, err := pu.MyIdentity()
+	if err != nil {
+		return nil, err
 	}
 	metadata := &pb.MetaData{
 		OriginalSender: sender,
@@ -3,6 +3,7 @@ package utils
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/libp2p/go-libp2p-core/peer"
@@ -13,34 +14,79 @@ import (
 
 type ResponsesProcessor func(string, []proto.Message, *StorageMetadata)
 
+// ResponseHandler is called with every single response as soon as it is put
+// into the storage, before all responses are aggregated
+type ResponseHandler func(string, proto.Message, *StorageMetadata)
+
 type StorageMetadata struct {
 	ResponsesReceiver peer.ID
 }
 
+type response struct {
+	responder peer.ID
+	msg       proto.Message
+}
+
 type Storage struct {
-	receivingCh chan proto.Message
+	receivingCh chan *response
+	removingCh  chan peer.ID
+	closingCh   chan []peer.ID
+	finishCh    chan struct{}
+	done        chan struct{}
 	metadata    *StorageMetadata
-	responses   []proto.Message
+	expected    int
+	pending     map[peer.ID]struct{}
+	// open storage is not full until its set of responders is closed
+	open      bool
+	responses []proto.Message
 }
 
-func NewStorage(maxResp int, metadata *StorageMetadata) *Storage {
+func NewStorage(responders []peer.ID, metadata *StorageMetadata) *Storage {
+	pending := make(map[peer.ID]struct{}, len(responders))
+	for _, p := range responders {
+		pending[p] = struct{}{}
+	}
 	return &Storage{
-		receivingCh: make(chan proto.Message),
-		responses:   make([]proto.Message, 0, maxResp),
+		receivingCh: make(chan *response),
+		removingCh:  make(chan peer.ID),
+		closingCh:   make(chan []peer.ID),
+		finishCh:    make(chan struct{}, 1),
+		done:        make(chan struct{}),
+		expected:    len(pending),
+		pending:     pending,
+		responses:   make([]proto.Message, 0, len(pending)),
 		metadata:    metadata,
 	}
 }
 
-func (s *Storage) addResp(message proto.Message) error {
-	if len(s.responses) == cap(s.responses) {
-		return errors.Errorf("putting new response into storage but all responses are already received")
+func (s *Storage) addResp(resp *response) error {
+	if _, ok := s.pending[resp.responder]; !ok {
+		return errors.Errorf("putting new response from %s into storage but no response is expected from it",
+			resp.responder)
 	}
-	s.responses = append(s.responses, message)
+	delete(s.pending, resp.responder)
+	s.responses = append(s.responses, resp.msg)
 	return nil
 }
 
+// removeResponder stops waiting for response of given peer
+func (s *Storage) removeResponder(p peer.ID) {
+	delete(s.pending, p)
+}
+
+// closeResponders adds the last responders and closes the set of responders
+func (s *Storage) closeResponders(responders []peer.ID) {
+	for _, p := range responders {
+		if _, ok := s.pending[p]; !ok {
+			s.pending[p] = struct{}{}
+			s.expected++
+		}
+	}
+	s.open = false
+}
+
 func (s *Storage) full() bool {
-	return len(s.responses) == cap(s.responses)
+	return len(s.pending) == 0 && !s.open
 }
 
 func (s *Storage) getAggregatedResponses() []proto.Message {
@@ -52,12 +98,14 @@ func (s *Storage) getMetadata() *StorageMetadata {
 }
 
 func (s *Storage) status() string {
-	return fmt.Sprintf("%d/%d", len(s.responses), cap(s.responses))
+	return fmt.Sprintf("%d/%d", len(s.responses), s.expected)
 }
 
 type ResponseAggregator struct {
+	lock            sync.Mutex
 	responseStorage map[string]*Storage
 	respProcessor   ResponsesProcessor
+	respHandler     ResponseHandler
 }
 
 func NewResponseAggregator(respProcessor ResponsesProcessor) *ResponseAggregator {
@@ -67,62 +115,186 @@ func NewResponseAggregator(respProcessor ResponsesProcessor) *ResponseAggregator
 	}
 }
 
-func (rsm *ResponseAggregator) StartWaiting(ctx context.Context, id string, meta *StorageMetadata, maxResp int, timeout time.Duration) error {
+// SetResponseHandler sets optional handler called with every received response
+func (rsm *ResponseAggregator) SetResponseHandler(handler ResponseHandler) {
+	rsm.respHandler = handler
+}
+
+// StartWaiting starts waiting for responses of given responders. Responses
+// are processed when all responders respond (or are removed) or when
+// timeout elapses
+func (rsm *ResponseAggregator) StartWaiting(ctx context.Context, id string, meta *StorageMetadata, responders []peer.ID, timeout time.Duration) error {
+	return rsm.startWaiting(ctx, id, meta, responders, timeout, false)
+}
+
+// StartWaitingOpen starts waiting for responses like StartWaiting, but more
+// responders can be added by CloseResponders later. Responses are not
+// processed before the set of responders is closed, unless timeout elapses
+// or the waiting is finished early
+func (rsm *ResponseAggregator) StartWaitingOpen(ctx context.Context, id string, meta *StorageMetadata, responders []peer.ID, timeout time.Duration) error {
+	return rsm.startWaiting(ctx, id, meta, responders, timeout, true)
+}
+
+func (rsm *ResponseAggregator) startWaiting(ctx context.Context, id string, meta *StorageMetadata, responders []peer.ID,
+	timeout time.Duration, open bool) error {
+	rsm.lock.Lock()
+	defer rsm.lock.Unlock()
+
 	_, exists := rsm.responseStorage[id]
 	if exists {
 		return errors.Errorf("there is already storage for responses on request id %s", id)
 	}
-	log.Debugf("starting waiting for %d responses with id %s with timeout %s", maxResp, id, timeout)
+	log.Debugf("starting waiting for %d responses with id %s with timeout %s", len(responders), id, timeout)
 
 	// create storage for this id
-	s := NewStorage(maxResp, meta)
+	s := NewStorage(responders, meta)
+	s.open = open
 	rsm.responseStorage[id] = s
 	go func() {
-		for {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		for !s.full() {
 			select {
-			case newMsg := <-s.receivingCh:
-				err := s.addResp(newMsg)
+			case newResp := <-s.receivingCh:
+				err := s.addResp(newResp)
 				if err != nil {
 					log.Errorf("error putting new resp into response storage: %s", err)
-				}
-				if s.full() {
-					log.Infof("aggregated all responses in response storage with id %s", id)
-					rsm.finish(id)
-					return
+				} else if rsm.respHandler != nil {
+					rsm.respHandler(id, newResp.msg, s.getMetadata())
 				}
 
-			case <-time.After(timeout):
+			case p := <-s.removingCh:
+				log.Debugf("not waiting anymore for response of %s in storage with id %s", p, id)
+				s.removeResponder(p)
+
+			case responders := <-s.closingCh:
+				log.Debugf("waiting also for %d more responses in storage with id %s", len(responders), id)
+				s.closeResponders(responders)
+
+			case <-timer.C:
 				log.Infof("timeout elapsed waiting for the responses with storage id %s, got %s responses", id,
 					s.status())
 				rsm.finish(id)
 				return
 
+			case <-s.finishCh:
+				log.Infof("finishing early waiting for the responses with storage id %s, got %s responses", id,
+					s.status())
+				rsm.finish(id)
+				return
+
 			case <-ctx.Done():
+				rsm.remove(id)
 				return
 			}
-
 		}
+		log.Infof("aggregated all responses in response storage with id %s, got %s responses", id, s.status())
+		rsm.finish(id)
 	}()
 	return nil
 }
 
-func (rsm *ResponseAggregator) finish(id string) {
-	// get storage with responses and metadata
+// remove deletes storage with given id and returns it
+func (rsm *ResponseAggregator) remove(id string) *Storage {
+	rsm.lock.Lock()
+	defer rsm.lock.Unlock()
+
 	s := rsm.responseStorage[id]
-	// delete it, this storage is done now
 	delete(rsm.responseStorage, id)
+	close(s.done)
+	return s
+}
+
+func (rsm *ResponseAggregator) finish(id string) {
+	// get storage with responses and metadata and delete it, this storage is done now
+	s := rsm.remove(id)
 	// process all the responses
 	rsm.respProcessor(id, s.getAggregatedResponses(), s.getMetadata())
 }
 
-func (rsm *ResponseAggregator) AddResponse(id string, msg proto.Message) error {
+func (rsm *ResponseAggregator) getStorage(id string) (*Storage, error) {
+	rsm.lock.Lock()
+	defer rsm.lock.Unlock()
+
 	storage, ok := rsm.responseStorage[id]
 	if !ok {
-		return errors.Errorf("trying to put response to non-existing storage with ID %s", id)
+		return nil, errors.Errorf("storage with ID %s does not exist", id)
+	}
+	return storage, nil
+}
+
+// AddResponse puts response of responder into storage with given id
+func (rsm *ResponseAggregator) AddResponse(id string, responder peer.ID, msg proto.Message) error {
+	storage, err := rsm.getStorage(id)
+	if err != nil {
+		return errors.WithMessage(err, "trying to put response to non-existing storage: ")
+	}
+	select {
+	case storage.receivingCh <- &response{responder: responder, msg: msg}:
+		return nil
+	case <-storage.done:
+		return errors.Errorf("tried to put new response into already finished storage with id %s", id)
+	}
+}
+
+// RemoveResponder stops waiting for response of given peer in storage with
+// given id. It is used when request could not be sent to the peer
+func (rsm *ResponseAggregator) RemoveResponder(id string, p peer.ID) error {
+	storage, err := rsm.getStorage(id)
+	if err != nil {
+		return errors.WithMessage(err, "trying to remove responder from non-existing storage: ")
+	}
+	select {
+	case storage.removingCh <- p:
+	case <-storage.done:
+	}
+	return nil
+}
+
+// CloseResponders adds the last responders to storage started by
+// StartWaitingOpen. The storage can finish as soon as all responders respond
+func (rsm *ResponseAggregator) CloseResponders(id string, responders []peer.ID) error {
+	storage, err := rsm.getStorage(id)
+	if err != nil {
+		return errors.WithMessage(err, "trying to add responders to non-existing storage: ")
+	}
+	select {
+	case storage.closingCh <- responders:
+		return nil
+	case <-storage.done:
+		return errors.Errorf("tried to add responders to already finished storage with id %s", id)
+	}
+}
+
+// PeerDisconnected stops waiting for responses of disconnected peer in all
+// storages
+func (rsm *ResponseAggregator) PeerDisconnected(p peer.ID) {
+	rsm.lock.Lock()
+	storages := make([]*Storage, 0, len(rsm.responseStorage))
+	for _, s := range rsm.responseStorage {
+		storages = append(storages, s)
+	}
+	rsm.lock.Unlock()
+
+	for _, s := range storages {
+		select {
+		case s.removingCh <- p:
+		case <-s.done:
+		}
+	}
+}
+
+// FinishEarly stops waiting for more responses of given id and processes
+// responses that were already received
+func (rsm *ResponseAggregator) FinishEarly(id string) error {
+	storage, err := rsm.getStorage(id)
+	if err != nil {
+		return errors.WithMessage(err, "trying to finish non-existing storage: ")
 	}
-	if storage.full() {
-		return errors.Errorf("tried to put new response into already full storage with id %s", id)
+	select {
+	case storage.finishCh <- struct{}{}:
+	default:
+		// storage is already being finished
 	}
-	storage.receivingCh <- msg
 	return nil
 }
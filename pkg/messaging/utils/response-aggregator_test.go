@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/libp2p/go-libp2p-core/peer"
+
+	"happystoic/p2pnetwork/pkg/messaging/pb"
+)
+
+// TestOpenStorageKeepsEarlyResponses simulates intelligence request whose TL
+// answers before children of the request are selected
+func TestOpenStorageKeepsEarlyResponses(t *testing.T) {
+	tl := peer.ID("tl")
+	childA, childB := peer.ID("child-a"), peer.ID("child-b")
+
+	tests := []struct {
+		name        string
+		children    []peer.ID
+		respond     []peer.ID
+		disconnect  []peer.ID
+		expected    int
+		waitTimeout bool
+	}{
+		{
+			name:     "children respond after TL",
+			children: []peer.ID{childA, childB},
+			respond:  []peer.ID{childA, childB},
+			expected: 3,
+		},
+		{
+			name:     "no children selected",
+			children: nil,
+			expected: 1,
+		},
+		{
+			name:       "disconnected child is not waited for",
+			children:   []peer.ID{childA, childB},
+			respond:    []peer.ID{childA},
+			disconnect: []peer.ID{childB},
+			expected:   2,
+		},
+		{
+			name:        "silent child makes storage time out",
+			children:    []peer.ID{childA},
+			expected:    1,
+			waitTimeout: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan []proto.Message, 1)
+			ra := NewResponseAggregator(func(_ string, responses []proto.Message, _ *StorageMetadata) {
+				done <- responses
+			})
+			timeout := 500 * time.Millisecond
+			if err := ra.StartWaitingOpen(ctx, "req", nil, []peer.ID{tl}, timeout); err != nil {
+				t.Fatalf("error starting waiting: %s", err)
+			}
+			start := time.Now()
+
+			// TL answers while children are still being selected
+			if err := ra.AddResponse("req", tl, &pb.IntelligenceResponse{}); err != nil {
+				t.Fatalf("response of TL was dropped: %s", err)
+			}
+			if err := ra.CloseResponders("req", tt.children); err != nil {
+				t.Fatalf("error adding children: %s", err)
+			}
+			for _, p := range tt.respond {
+				if err := ra.AddResponse("req", p, &pb.IntelligenceResponse{}); err != nil {
+					t.Fatalf("response of %s was dropped: %s", p, err)
+				}
+			}
+			for _, p := range tt.disconnect {
+				ra.PeerDisconnected(p)
+			}
+
+			select {
+			case responses := <-done:
+				if len(responses) != tt.expected {
+					t.Fatalf("got %d responses, expected %d", len(responses), tt.expected)
+				}
+				if timedOut := time.Since(start) >= timeout; timedOut != tt.waitTimeout {
+					t.Fatalf("storage finished after %s with timeout %s", time.Since(start), timeout)
+				}
+			case <-time.After(5 * timeout):
+				t.Fatal("responses were not processed")
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	"github.com/pkg/errors"
+
+	"happystoic/p2pnetwork/pkg/messaging/pb"
+	"happystoic/p2pnetwork/pkg/org"
+)
+
+// MessageFactory creates new empty protocol specific message, so the RPC layer
+// can unmarshal received payloads into it
+type MessageFactory func() proto.Message
+
+// RpcRequestHandler is called with every authenticated request. Handler can
+// respond immediately or later (e.g. after TL answers through Redis)
+type RpcRequestHandler func(req *RpcIncomingRequest)
+
+// RpcResultsHandler is called once with all responses when quorum is reached,
+// all responders respond or the deadline elapses
+type RpcResultsHandler func(requestId string, results []*RpcResult)
+
+// RpcResult is authenticated response of one responder
+type RpcResult struct {
+	Responder peer.ID
+	Response  proto.Message
+}
+
+// RpcIncomingRequest is authenticated request received from another peer
+type RpcIncomingRequest struct {
+	Id       string
+	Sender   peer.ID
+	Deadline time.Time
+	Request  proto.Message
+
+	rpc *Rpc
+}
+
+// Respond signs the response and sends it back to the requester
+func (r *RpcIncomingRequest) Respond(resp proto.Message) error {
+	if time.Now().After(r.Deadline) {
+		return errors.Errorf("deadline of rpc request %s already elapsed", r.Id)
+	}
+	payload, err := proto.Marshal(resp)
+	if err != nil {
+		return errors.WithMessage(err, "error marshalling rpc response: ")
+	}
+	metadata, err := r.rpc.NewProtoMetaData()
+	if err != nil {
+		return errors.WithMessage(err, "error generating new proto metadata: ")
+	}
+	rpcResp := &pb.RpcResponse{
+		Metadata:  metadata,
+		RequestId: r.Id,
+		Payload:   payload,
+	}
+	signature, err := r.rpc.SignProtoMessage(rpcResp)
+	if err != nil {
+		return errors.WithMessage(err, "error generating signature for rpc response: ")
+	}
+	rpcResp.Metadata.Signature = signature
+	return r.rpc.SendProtoMessage(r.Sender, r.rpc.responseProtocol, rpcResp)
+}
+
+// CallOptions describe who is asked and how long the requester waits
+type CallOptions struct {
+	// Peers to send the request to. If empty, Fanout connected peers are
+	// selected by their reliability
+	Peers  []peer.ID
+	Fanout int
+	// Rights restrict selected peers to members of these organisations
+	Rights []*org.Org
+	// Quorum is number of responses after which the call finishes without
+	// waiting for the rest. Zero means waiting for all responders
+	Quorum  int
+	Timeout time.Duration
+}
+
+type rpcCall struct {
+	quorum    int
+	received  int
+	onResults RpcResultsHandler
+}
+
+// Rpc is generic request/response layer for protocols. It takes care of
+// signing and authenticating messages, correlation of responses with
+// requests, fan-out, quorum and deadlines. Protocols provide only typed
+// messages and handlers. Requests are single-hop, they are not forwarded by
+// responders
+type Rpc struct {
+	*ProtoUtils
+
+	ctx              context.Context
+	requestProtocol  protocol.ID
+	responseProtocol protocol.ID
+	newRequest       MessageFactory
+	newResponse      MessageFactory
+	handler          RpcRequestHandler
+	respStorage      *ResponseAggregator
+
+	callsLock sync.Mutex
+	calls     map[string]*rpcCall
+}
+
+// NewRpc creates RPC protocol with given name and registers its stream
+// handlers. Requests are delivered to handler
+func NewRpc(ctx context.Context, pu *ProtoUtils, name string, newRequest, newResponse MessageFactory,
+	handler RpcRequestHandler) *Rpc {
+	r := &Rpc{
+		ProtoUtils:       pu,
+		ctx:              ctx,
+		requestProtocol:  protocol.ID(fmt.Sprintf("/%s-rpc-request/0.0.1", name)),
+		responseProtocol: protocol.ID(fmt.Sprintf("/%s-rpc-response/0.0.1", name)),
+		newRequest:       newRequest,
+		newResponse:      newResponse,
+		handler:          handler,
+		calls:            make(map[string]*rpcCall),
+	}
+	r.respStorage = NewResponseAggregator(r.onAggregatedResponses)
+	r.respStorage.SetResponseHandler(r.onStoredResponse)
+
+	r.Host.SetStreamHandler(r.requestProtocol, r.onRequest)
+	r.Host.SetStreamHandler(r.responseProtocol, r.onResponse)
+	return r
+}
+
+// Call sends the request to peers selected according to opts and returns ID
+// of the request. onResults is called with all collected responses
+func (r *Rpc) Call(req proto.Message, opts *CallOptions, onResults RpcResultsHandler) (string, error) {
+	receivers := opts.Peers
+	if len(receivers) == 0 {
+		var err error
+		receivers, err = r.GetNPeersExpProb(r.ConnectedPeers(), opts.Fanout, opts.Rights, nil)
+		if err != nil {
+			return "", errors.WithMessage(err, "error selecting receivers of rpc request: ")
+		}
+	}
+
+	rpcReq, err := r.createRequest(req, time.Now().Add(opts.Timeout))
+	if err != nil {
+		return "", err
+	}
+	reqId := rpcReq.Metadata.Id
+	r.NewMsgSeen(reqId, r.Host.ID())
+
+	// start waiter, who will process all responses when they are aggregated or timeout elapses
+	r.addCall(reqId, &rpcCall{quorum: opts.Quorum, onResults: onResults})
+	err = r.respStorage.StartWaiting(r.ctx, reqId, nil, receivers, opts.Timeout)
+	if err != nil {
+		r.takeCall(reqId)
+		return "", errors.WithMessage(err, "error when starting to wait for rpc responses: ")
+	}
+
+	for _, pid := range receivers {
+		log.Debugf("sending rpc request %s to peer %s", r.requestProtocol, pid)
+		err = r.SendProtoMessage(pid, r.requestProtocol, rpcReq)
+		if err != nil {
+			log.Errorf("error sending rpc request %s to node %s: %s", r.requestProtocol, pid, err)
+			// do not wait for response that will never come
+			_ = r.respStorage.RemoveResponder(reqId, pid)
+		}
+	}
+	return reqId, nil
+}
+
+func (r *Rpc) createRequest(req proto.Message, deadline time.Time) (*pb.RpcRequest, error) {
+	payload, err := proto.Marshal(req)
+	if err != nil {
+		return nil, errors.WithMessage(err, "error marshalling rpc request: ")
+	}
+	metadata, err := r.NewProtoMetaData()
+	if err != nil {
+		return nil, errors.WithMessage(err, "error generating new proto metadata: ")
+	}
+	rpcReq := &pb.RpcRequest{
+		Metadata: metadata,
+		Deadline: deadline.UnixMilli(),
+		Payload:  payload,
+	}
+	signature, err := r.SignProtoMessage(rpcReq)
+	if err != nil {
+		return nil, errors.WithMessage(err, "error generating signature for rpc request: ")
+	}
+	rpcReq.Metadata.Signature = signature
+	return rpcReq, nil
+}
+
+func (r *Rpc) onRequest(s network.Stream) {
+	log.Infof("received rpc request %s", r.requestProtocol)
+	rpcReq := &pb.RpcRequest{}
+
+	err := r.DeserializeMessageFromStream(s, rpcReq, true)
+	if err != nil {
+		log.Errorf("error deserialising rpc request from stream: %s", err)
+		return
+	}
+	err = r.AuthenticateMessage(rpcReq, rpcReq.Metadata)
+	if err != nil {
+		log.Errorf("error authenticating rpc request: %s", err)
+		return
+	}
+	if r.WasMsgSeen(rpcReq.Metadata.Id) {
+		log.Debugf("received already seen rpc request with id %s", rpcReq.Metadata.Id)
+		return
+	}
+	r.NewMsgSeen(rpcReq.Metadata.Id, s.Conn().RemotePeer())
+
+	deadline := time.UnixMilli(rpcReq.Deadline)
+	if time.Now().After(deadline) {
+		log.Debugf("deadline of rpc request %s already elapsed", rpcReq.Metadata.Id)
+		return
+	}
+	req := r.newRequest()
+	err = proto.Unmarshal(rpcReq.Payload, req)
+	if err != nil {
+		log.Errorf("error unmarshalling payload of rpc request: %s", err)
+		return
+	}
+	r.handler(&RpcIncomingRequest{
+		Id:       rpcReq.Metadata.Id,
+		Sender:   s.Conn().RemotePeer(),
+		Deadline: deadline,
+		Request:  req,
+		rpc:      r,
+	})
+}
+
+func (r *Rpc) onResponse(s network.Stream) {
+	log.Infof("received rpc response %s", r.responseProtocol)
+	rpcResp := &pb.RpcResponse{}
+
+	err := r.DeserializeMessageFromStream(s, rpcResp, true)
+	if err != nil {
+		log.Errorf("error deserialising rpc response from stream: %s", err)
+		return
+	}
+	err = r.AuthenticateMessage(rpcResp, rpcResp.Metadata)
+	if err != nil {
+		log.Errorf("error authenticating rpc response: %s", err)
+		return
+	}
+	// responses are sent directly to the requester, so the responder must be
+	// the author of the response
+	if rpcResp.Metadata.OriginalSender.NodeId != s.Conn().RemotePeer().String() {
+		log.Errorf("rpc response from %s was authored by another peer %s", s.Conn().RemotePeer(),
+			rpcResp.Metadata.OriginalSender.NodeId)
+		return
+	}
+	err = r.respStorage.AddResponse(rpcResp.RequestId, s.Conn().RemotePeer(), rpcResp)
+	if err != nil {
+		log.Errorf("error adding rpc response to respStorage with id '%s': '%s'", rpcResp.RequestId, err)
+	}
+}
+
+// onStoredResponse finishes the call early when quorum of responses is reached
+func (r *Rpc) onStoredResponse(requestId string, _ proto.Message, _ *StorageMetadata) {
+	r.callsLock.Lock()
+	call, exists := r.calls[requestId]
+	quorumReached := false
+	if exists {
+		call.received++
+		quorumReached = call.quorum > 0 && call.received >= call.quorum
+	}
+	r.callsLock.Unlock()
+
+	if quorumReached {
+		_ = r.respStorage.FinishEarly(requestId)
+	}
+}
+
+func (r *Rpc) onAggregatedResponses(requestId string, responses []proto.Message, _ *StorageMetadata) {
+	call := r.takeCall(requestId)
+	if call == nil {
+		return
+	}
+	results := make([]*RpcResult, 0, len(responses))
+	for _, msg := range responses {
+		rpcResp := msg.(*pb.RpcResponse)
+		responder, err := peer.Decode(rpcResp.Metadata.OriginalSender.NodeId)
+		if err != nil {
+			log.Errorf("error decoding peer ID of rpc responder: %s", err)
+			continue
+		}
+		resp := r.newResponse()
+		err = proto.Unmarshal(rpcResp.Payload, resp)
+		if err != nil {
+			log.Errorf("error unmarshalling payload of rpc response from %s: %s", responder, err)
+			continue
+		}
+		results = append(results, &RpcResult{Responder: responder, Response: resp})
+	}
+	call.onResults(requestId, results)
+}
+
+// PeerDisconnected stops waiting for responses of disconnected peer
+func (r *Rpc) PeerDisconnected(p peer.ID) {
+	r.respStorage.PeerDisconnected(p)
+}
+
+func (r *Rpc) addCall(requestId string, call *rpcCall) {
+	r.callsLock.Lock()
+	defer r.callsLock.Unlock()
+	r.calls[requestId] = call
+}
+
+func (r *Rpc) takeCall(requestId string) *rpcCall {
+	r.callsLock.Lock()
+	defer r.callsLock.Unlock()
+	call := r.calls[requestId]
+	delete(r.calls, requestId)
+	return call
+}
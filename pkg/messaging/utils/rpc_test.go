@@ -0,0 +1,247 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	csms "github.com/libp2p/go-conn-security-multistream"
+	blankhost "github.com/libp2p/go-libp2p-blankhost"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/libp2p/go-libp2p-core/sec/insecure"
+	"github.com/libp2p/go-libp2p-peerstore/pstoremem"
+	swarm "github.com/libp2p/go-libp2p-swarm"
+	tptu "github.com/libp2p/go-libp2p-transport-upgrader"
+	yamux "github.com/libp2p/go-libp2p-yamux"
+	msmux "github.com/libp2p/go-stream-muxer-multistream"
+	tcp "github.com/libp2p/go-tcp-transport"
+	ma "github.com/multiformats/go-multiaddr"
+
+	"happystoic/p2pnetwork/pkg/cryptotools"
+	"happystoic/p2pnetwork/pkg/messaging/pb"
+)
+
+func newTestRequest() proto.Message  { return &pb.RecommendationRequest{} }
+func newTestResponse() proto.Message { return &pb.RecommendationResponse{} }
+
+// newTestHost creates host listening on localhost with tcp transport only
+func newTestHost(t *testing.T) host.Host {
+	sk, pk, err := crypto.GenerateEd25519Key(nil)
+	if err != nil {
+		t.Fatalf("error generating key: %s", err)
+	}
+	id, err := peer.IDFromPublicKey(pk)
+	if err != nil {
+		t.Fatalf("error deriving peer id: %s", err)
+	}
+	ps, err := pstoremem.NewPeerstore()
+	if err != nil {
+		t.Fatalf("error creating peerstore: %s", err)
+	}
+	_ = ps.AddPrivKey(id, sk)
+	_ = ps.AddPubKey(id, pk)
+
+	s, err := swarm.NewSwarm(id, ps)
+	if err != nil {
+		t.Fatalf("error creating swarm: %s", err)
+	}
+	secMuxer := new(csms.SSMuxer)
+	secMuxer.AddTransport(insecure.ID, insecure.NewWithIdentity(id, sk))
+	stMuxer := msmux.NewBlankTransport()
+	stMuxer.AddTransport("/yamux/1.0.0", yamux.DefaultTransport)
+	tpt, err := tcp.NewTCPTransport(&tptu.Upgrader{Secure: secMuxer, Muxer: stMuxer})
+	if err != nil {
+		t.Fatalf("error creating tcp transport: %s", err)
+	}
+	if err = s.AddTransport(tpt); err != nil {
+		t.Fatalf("error adding tcp transport: %s", err)
+	}
+	if err = s.Listen(ma.StringCast("/ip4/127.0.0.1/tcp/0")); err != nil {
+		t.Fatalf("error listening: %s", err)
+	}
+	h := blankhost.NewBlankHost(s)
+	t.Cleanup(func() { _ = h.Close() })
+	return h
+}
+
+// newTestRpcs creates len(handlers) connected peers with rpc protocol.
+// Requests received by i-th peer are handled by handlers[i]
+func newTestRpcs(t *testing.T, ctx context.Context, handlers []RpcRequestHandler) []*Rpc {
+	rpcs := make([]*Rpc, 0, len(handlers))
+	for i := range handlers {
+		h := newTestHost(t)
+		for _, r := range rpcs {
+			h.Peerstore().AddAddrs(r.Host.ID(), r.Host.Addrs(), peerstore.PermanentAddrTTL)
+			r.Host.Peerstore().AddAddrs(h.ID(), h.Addrs(), peerstore.PermanentAddrTTL)
+			if err := h.Connect(ctx, peer.AddrInfo{ID: r.Host.ID()}); err != nil {
+				t.Fatalf("error connecting peers: %s", err)
+			}
+		}
+		pu := NewProtoUtils(cryptotools.NewCryptoKit(h), h, nil, nil, nil, nil)
+		rpcs = append(rpcs, NewRpc(ctx, pu, "test", newTestRequest, newTestResponse, handlers[i]))
+	}
+	return rpcs
+}
+
+func respondWith(payload string) RpcRequestHandler {
+	return func(req *RpcIncomingRequest) {
+		_ = req.Respond(&pb.RecommendationResponse{Payload: []byte(payload)})
+	}
+}
+
+func noResponse(*RpcIncomingRequest) {}
+
+// call calls peers of rpcs[1:] from rpcs[0] and waits for the results
+func call(t *testing.T, rpcs []*Rpc, quorum int, timeout time.Duration) ([]*RpcResult, time.Duration) {
+	peers := make([]peer.ID, 0, len(rpcs)-1)
+	for _, r := range rpcs[1:] {
+		peers = append(peers, r.Host.ID())
+	}
+	done := make(chan []*RpcResult, 1)
+	start := time.Now()
+	_, err := rpcs[0].Call(&pb.RecommendationRequest{Payload: []byte("question")},
+		&CallOptions{Peers: peers, Quorum: quorum, Timeout: timeout},
+		func(_ string, results []*RpcResult) { done <- results })
+	if err != nil {
+		t.Fatalf("error calling rpc: %s", err)
+	}
+	select {
+	case results := <-done:
+		return results, time.Since(start)
+	case <-time.After(timeout + 5*time.Second):
+		t.Fatal("rpc results were not delivered")
+		return nil, 0
+	}
+}
+
+func TestRpcCall(t *testing.T) {
+	tests := []struct {
+		name          string
+		responders    []RpcRequestHandler
+		quorum        int
+		timeout       time.Duration
+		minResults    int
+		maxResults    int
+		shouldTimeout bool
+	}{
+		{
+			name:       "all responders respond",
+			responders: []RpcRequestHandler{respondWith("a"), respondWith("b"), respondWith("c")},
+			timeout:    10 * time.Second,
+			minResults: 3,
+			maxResults: 3,
+		},
+		{
+			name:       "quorum finishes call early",
+			responders: []RpcRequestHandler{respondWith("a"), respondWith("b"), noResponse},
+			quorum:     2,
+			timeout:    10 * time.Second,
+			minResults: 2,
+			maxResults: 2,
+		},
+		{
+			name:          "timeout delivers received responses",
+			responders:    []RpcRequestHandler{respondWith("a"), noResponse},
+			timeout:       300 * time.Millisecond,
+			minResults:    1,
+			maxResults:    1,
+			shouldTimeout: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			rpcs := newTestRpcs(t, ctx, append([]RpcRequestHandler{noResponse}, tt.responders...))
+
+			results, elapsed := call(t, rpcs, tt.quorum, tt.timeout)
+			if len(results) < tt.minResults || len(results) > tt.maxResults {
+				t.Fatalf("got %d results, expected between %d and %d", len(results), tt.minResults, tt.maxResults)
+			}
+			if tt.shouldTimeout != (elapsed >= tt.timeout) {
+				t.Fatalf("call finished after %s with timeout %s", elapsed, tt.timeout)
+			}
+			for _, result := range results {
+				if string(result.Response.(*pb.RecommendationResponse).Payload) == "" {
+					t.Fatalf("empty response of %s", result.Responder)
+				}
+			}
+		})
+	}
+}
+
+func TestRpcRejectsUnauthenticResponses(t *testing.T) {
+	tests := []struct {
+		name  string
+		forge func(resp *pb.RpcResponse, other *Rpc) *pb.RpcResponse
+	}{
+		{
+			name: "payload changed after signing",
+			forge: func(resp *pb.RpcResponse, _ *Rpc) *pb.RpcResponse {
+				resp.Payload = []byte("forged")
+				return resp
+			},
+		},
+		{
+			name: "response authored by another peer",
+			forge: func(resp *pb.RpcResponse, other *Rpc) *pb.RpcResponse {
+				metadata, _ := other.NewProtoMetaData()
+				forged := &pb.RpcResponse{Metadata: metadata, RequestId: resp.RequestId, Payload: resp.Payload}
+				forged.Metadata.Signature, _ = other.SignProtoMessage(forged)
+				return forged
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var rpcs []*Rpc
+			forger := func(req *RpcIncomingRequest) {
+				responder := req.rpc
+				metadata, _ := responder.NewProtoMetaData()
+				resp := &pb.RpcResponse{Metadata: metadata, RequestId: req.Id, Payload: []byte{}}
+				resp.Metadata.Signature, _ = responder.SignProtoMessage(resp)
+				resp = tt.forge(resp, rpcs[2])
+				_ = responder.SendProtoMessage(req.Sender, responder.responseProtocol, resp)
+			}
+			rpcs = newTestRpcs(t, ctx, []RpcRequestHandler{noResponse, forger, noResponse})
+
+			results, _ := call(t, rpcs[:2], 0, 500*time.Millisecond)
+			if len(results) != 0 {
+				t.Fatalf("forged response was accepted")
+			}
+		})
+	}
+}
+
+func TestRpcPeerDisconnected(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rpcs := newTestRpcs(t, ctx, []RpcRequestHandler{noResponse, respondWith("a"), noResponse})
+
+	timeout := 10 * time.Second
+	done := make(chan []*RpcResult, 1)
+	_, err := rpcs[0].Call(&pb.RecommendationRequest{},
+		&CallOptions{Peers: []peer.ID{rpcs[1].Host.ID(), rpcs[2].Host.ID()}, Timeout: timeout},
+		func(_ string, results []*RpcResult) { done <- results })
+	if err != nil {
+		t.Fatalf("error calling rpc: %s", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	rpcs[0].PeerDisconnected(rpcs[2].Host.ID())
+
+	select {
+	case results := <-done:
+		if len(results) != 1 {
+			t.Fatalf("got %d results, expected 1", len(results))
+		}
+	case <-time.After(timeout / 2):
+		t.Fatal("call is still waiting for disconnected peer")
+	}
+}
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+type cacheEntry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+// TtlCache is a bounded cache where every value has its own time to live.
+// When the cache is full, the value closest to its expiration is dropped
+type TtlCache struct {
+	lock    sync.Mutex
+	maxSize int
+	entries map[string]*cacheEntry
+}
+
+func NewTtlCache(maxSize int) *TtlCache {
+	return &TtlCache{
+		maxSize: maxSize,
+		entries: make(map[string]*cacheEntry),
+	}
+}
+
+// Put stores value under given key for ttl. Existing value is replaced
+func (c *TtlCache) Put(key string, value interface{}, ttl time.Duration) {
+	if c.maxSize <= 0 || ttl <= 0 {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, exists := c.entries[key]; !exists {
+		c.purge()
+		if len(c.entries) >= c.maxSize {
+			c.dropSoonestExpiring()
+		}
+	}
+	c.entries[key] = &cacheEntry{value: value, expiresAt: time.Now().Add(ttl)}
+}
+
+func (c *TtlCache) Get(key string) (interface{}, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, exists := c.entries[key]
+	if !exists {
+		return nil, false
+	}
+	if !time.Now().Before(entry.expiresAt) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// Take returns value and removes it from the cache
+func (c *TtlCache) Take(key string) (interface{}, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry, exists := c.entries[key]
+	if !exists {
+		return nil, false
+	}
+	delete(c.entries, key)
+	if !time.Now().Before(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+// purge drops expired values. Lock must be held
+func (c *TtlCache) purge() {
+	now := time.Now()
+	for key, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// dropSoonestExpiring drops value closest to its expiration. Lock must be held
+func (c *TtlCache) dropSoonestExpiring() {
+	var soonestKey string
+	var soonest time.Time
+	for key, entry := range c.entries {
+		if soonestKey == "" || entry.expiresAt.Before(soonest) {
+			soonestKey, soonest = key, entry.expiresAt
+		}
+	}
+	delete(c.entries, soonestKey)
+}
@@ -96,6 +96,10 @@ func NewNode(conf *config.Config, ctx context.Context) (*Node, error) {
 	// setup books
 	relBook := reliability.NewBook()
 	fileBook := files.NewFileBook()
+	feedStore, err := files.LoadFeedStore(conf.ProtocolSettings.FileShare.FeedStateFile)
+	if err != nil {
+		return nil, errors.Errorf("error loading feed store: %s", err)
+	}
 	orgBook, err := org.NewBook(&conf.Organisations, dht, p2phost.ID())
 	if err != nil {
 		return nil, errors.Errorf("error creating org book: %s", err)
@@ -117,20 +121,24 @@ func NewNode(conf *config.Config, ctx context.Context) (*Node, error) {
 
 	// setup all protocols
 	n.OrgSigProtocol = protocols.NewOrgSigProtocol(protoUtils)
-	n.AlertProtocol = protocols.NewAlertProtocol(protoUtils)
+	n.AlertProtocol = protocols.NewAlertProtocol(ctx, protoUtils, &conf.ProtocolSettings.Alert)
 	n.RecommendationProtocol = protocols.NewRecommendationProtocol(ctx, protoUtils, &conf.ProtocolSettings.Recommendation)
 	n.IntelligenceProtocol = protocols.NewIntelligenceProtocol(ctx, protoUtils, &conf.ProtocolSettings.Intelligence)
-	n.FileShareProtocol = protocols.NewFileShareProtocol(ctx, protoUtils, fileBook, dht, &conf.ProtocolSettings.FileShare)
+	n.FileShareProtocol = protocols.NewFileShareProtocol(ctx, protoUtils, fileBook, feedStore, dht,
+		&conf.ProtocolSettings.FileShare)
 	_ = protocols.NewReliabilityReceiver(protoUtils, relBook)
 
 	connecter := connmgr.NewConnecter(&conf.Connections, protoUtils)
 	connecter.Start(ctx)
 
 	// inject missing dependencies
-	cm.SetDeps(protoUtils, n.OrgSigProtocol, connecter)
+	cm.SetDeps(protoUtils, n.OrgSigProtocol, n.AlertProtocol, connecter)
 
 	// setup callbacks
 	relBook.SubscribeForChange(cm.SetReliabilityTagCallback())
+	cm.SubscribeForDisconnect(n.IntelligenceProtocol.PeerDisconnected)
+	cm.SubscribeForDisconnect(n.RecommendationProtocol.PeerDisconnected)
+	fileBook.RunJanitor(ctx, conf.ProtocolSettings.FileShare.ExpiryCheckPeriod, n.FileShareProtocol.OnFileExpired)
 
 	return n, nil
 }
@@ -172,6 +180,9 @@ func (n *Node) Start(ctx context.Context) {
 	// tell the network which organisations I am member of
 	n.advertiseMyOrgs(ctx)
 
+	// tell the network which intelligence topics I am expert in
+	n.AdvertiseTopics()
+
 	// block running
 	<-make(chan struct{})
 }
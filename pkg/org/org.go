@@ -67,6 +67,19 @@ func Decode(s string) (*Org, error) {
 	return &x, nil
 }
 
+// DecodeAll decodes list of Orgs from their string ID representations
+func DecodeAll(ss []string) ([]*Org, error) {
+	orgs := make([]*Org, 0, len(ss))
+	for _, s := range ss {
+		o, err := Decode(s)
+		if err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, o)
+	}
+	return orgs, nil
+}
+
 // SignPeer signs given peer. It signs raw bytes of peer public key which means
 // it basically signs peer's ID. It returns signature encoded in base64
 func SignPeer(key crypto.PrivKey, p peer.ID) (string, error) {